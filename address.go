@@ -0,0 +1,107 @@
+package bootstrap
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/golemfactory/bootstrap_go/python"
+)
+
+// hostIP parses the host part of an address, dropping the IPv6 zone
+// identifier which has no meaning outside of the local host.
+// IPv4-mapped IPv6 addresses are returned in the 4-byte form.
+func hostIP(host string) net.IP {
+	if idx := strings.LastIndex(host, "%"); idx >= 0 {
+		host = host[:idx]
+	}
+	ip := net.ParseIP(host)
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+func addrIP(addr net.Addr) net.IP {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+	return hostIP(host)
+}
+
+// peerAddress returns the address stored in the peer record for
+// a connection from addr.
+func peerAddress(addr net.Addr) (string, error) {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return "", err
+	}
+	if ip := hostIP(host); ip != nil {
+		return ip.String(), nil
+	}
+	return host, nil
+}
+
+type addrFamilies struct {
+	ipv4 bool
+	ipv6 bool
+}
+
+func (f addrFamilies) add(host string) addrFamilies {
+	ip := hostIP(host)
+	if ip == nil {
+		return f
+	}
+	if ip.To4() != nil {
+		f.ipv4 = true
+	} else {
+		f.ipv6 = true
+	}
+	return f
+}
+
+func (f addrFamilies) known() bool {
+	return f.ipv4 || f.ipv6
+}
+
+func (f addrFamilies) overlap(other addrFamilies) bool {
+	return (f.ipv4 && other.ipv4) || (f.ipv6 && other.ipv6)
+}
+
+// publicFamilies returns the address families under which the peer
+// is reachable from the outside: the observed and the declared public
+// address.
+func publicFamilies(peer *python.Peer) addrFamilies {
+	f := addrFamilies{}.add(peer.Address)
+	if peer.Node != nil {
+		f = f.add(peer.Node.PubAddr)
+	}
+	return f
+}
+
+// reachablePeers filters out the peers which don't share an address
+// family with the client, e.g. IPv4-only peers for an IPv6-only client.
+// Peers and clients with no known family are never filtered out.
+func reachablePeers(peers []python.Peer, client *python.Peer) []python.Peer {
+	clientFamilies := publicFamilies(client)
+	if !clientFamilies.known() {
+		return peers
+	}
+	// the slice may be shared by the keeper
+	res := make([]python.Peer, 0, len(peers))
+	for idx := range peers {
+		f := publicFamilies(&peers[idx])
+		if !f.known() || f.overlap(clientFamilies) {
+			res = append(res, peers[idx])
+		}
+	}
+	return res
+}
+
+// listenAddr returns the address to listen on for the given host,
+// an empty host listens on all the addresses of both families.
+func listenAddr(host string, port uint64) string {
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	return net.JoinHostPort(host, strconv.FormatUint(port, 10))
+}
@@ -0,0 +1,102 @@
+package bootstrap
+
+import (
+	"net"
+	"testing"
+
+	"github.com/golemfactory/bootstrap_go/message"
+	"github.com/golemfactory/bootstrap_go/proxyproto"
+	"github.com/golemfactory/bootstrap_go/python"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostIP(t *testing.T) {
+	assert.Equal(t, "1.2.3.4", hostIP("1.2.3.4").String())
+	assert.Equal(t, "1.2.3.4", hostIP("::ffff:1.2.3.4").String())
+	assert.Equal(t, "fe80::1", hostIP("fe80::1%eth0").String())
+	assert.Nil(t, hostIP("test-addr"))
+
+	addr, err := peerAddress(&net.TCPAddr{IP: net.ParseIP("fe80::1"), Port: 1, Zone: "eth0"})
+	require.NoError(t, err)
+	assert.Equal(t, "fe80::1", addr)
+	addr, err = peerAddress(&TestAddress{})
+	require.NoError(t, err)
+	assert.Equal(t, "test-addr", addr)
+}
+
+func TestListenAddr(t *testing.T) {
+	assert.Equal(t, ":40102", listenAddr("", 40102))
+	assert.Equal(t, "0.0.0.0:40102", listenAddr("0.0.0.0", 40102))
+	assert.Equal(t, "[::]:40102", listenAddr("::", 40102))
+	assert.Equal(t, "[::1]:40102", listenAddr("[::1]", 40102))
+	assert.Equal(t, "[fe80::1%eth0]:40102", listenAddr("fe80::1%eth0", 40102))
+}
+
+func TestReachablePeers(t *testing.T) {
+	peers := []python.Peer{
+		{NodeName: "ipv4", Address: "1.2.3.4"},
+		{NodeName: "ipv6", Address: "2001:db8::1"},
+		{NodeName: "dual", Address: "1.2.3.5", Node: &python.Node{PubAddr: "2001:db8::2"}},
+		{NodeName: "unknown", Address: "test-addr"},
+	}
+	names := func(peers []python.Peer) []string {
+		res := make([]string, len(peers))
+		for idx, p := range peers {
+			res[idx] = p.NodeName
+		}
+		return res
+	}
+	filter := func(client python.Peer) []string {
+		return names(reachablePeers(peers, &client))
+	}
+
+	assert.Equal(t, []string{"ipv6", "dual", "unknown"}, filter(python.Peer{Address: "2001:db8::3"}))
+	assert.Equal(t, []string{"ipv4", "dual", "unknown"}, filter(python.Peer{Address: "1.2.3.6"}))
+	// the keeper's slice is left intact
+	assert.Equal(t, []string{"ipv4", "ipv6", "dual", "unknown"}, names(peers))
+	assert.Equal(t, names(peers), filter(python.Peer{Address: "test-addr"}))
+	assert.Equal(t, names(peers), filter(python.Peer{
+		Address: "1.2.3.6",
+		Node:    &python.Node{PubAddr: "2001:db8::3"},
+	}))
+}
+
+func TestIPv6PeerSession(t *testing.T) {
+	config := getConfig()
+	config.AllowReservedAddresses = true
+	pk := NewTestPeerKeeper()
+	service := getService(t, config, pk)
+	handleCh := make(chan error, 1)
+	addr := &net.TCPAddr{IP: net.ParseIP("fe80::1"), Port: 40102, Zone: "eth0"}
+	client := startNetworkSession(t, service, service.networks[0], addr, handleCh)
+
+	client.handshake("ipv6-client")
+	client.receive()
+	disconnect := client.receive().(*message.Disconnect)
+	assert.Equal(t, message.DISCONNECT_BOOTSTRAP, disconnect.Reason)
+	require.NoError(t, <-handleCh)
+	require.Equal(t, 1, len(pk.AddPeerCalls))
+	assert.Equal(t, "fe80::1", pk.AddPeerCalls[0].Peer.Address)
+}
+
+func TestProxiedPeerSession(t *testing.T) {
+	config := getConfig()
+	trusted, err := proxyproto.ParseCIDRs("10.0.0.0/8")
+	require.NoError(t, err)
+	config.ProxyTrusted = trusted
+	pk := NewTestPeerKeeper()
+	service := getService(t, config, pk)
+	handleCh := make(chan error, 1)
+	addr := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 40102}
+	client := startNetworkSession(t, service, service.networks[0], addr, handleCh)
+	_, err = client.conn.Write([]byte("PROXY TCP6 2001:db8::1 2001:db8::2 51234 40102\r\n"))
+	require.NoError(t, err)
+
+	client.handshake("proxied-client")
+	client.receive()
+	client.receive()
+	require.NoError(t, <-handleCh)
+	require.Equal(t, 1, len(pk.AddPeerCalls))
+	assert.Equal(t, "2001:db8::1", pk.AddPeerCalls[0].Peer.Address)
+}
@@ -0,0 +1,350 @@
+package ban
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golemfactory/bootstrap_go/clock"
+)
+
+type RuleType = string
+
+const (
+	RULE_CIDR RuleType = "cidr"
+	RULE_KEY  RuleType = "key"
+)
+
+type Rule struct {
+	Type RuleType `json:"type"`
+	// Value is a CIDR (or a single IP) for RULE_CIDR and a hex encoded
+	// node key for RULE_KEY.
+	Value  string `json:"value"`
+	Reason string `json:"reason,omitempty"`
+	// Expires is zero for permanent rules.
+	Expires time.Time `json:"expires"`
+}
+
+func (self *Rule) expired(now time.Time) bool {
+	return !self.Expires.IsZero() && !now.Before(self.Expires)
+}
+
+// normalize validates the rule and brings its value to the canonical form.
+func (self *Rule) normalize() (*net.IPNet, error) {
+	switch self.Type {
+	case RULE_CIDR:
+		if !strings.Contains(self.Value, "/") {
+			ip := net.ParseIP(self.Value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", self.Value)
+			}
+			if ip4 := ip.To4(); ip4 != nil {
+				self.Value = ip4.String() + "/32"
+			} else {
+				self.Value = ip.String() + "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(self.Value)
+		if err != nil {
+			return nil, err
+		}
+		self.Value = ipNet.String()
+		return ipNet, nil
+	case RULE_KEY:
+		self.Value = strings.ToLower(self.Value)
+		if self.Value == "" {
+			return nil, fmt.Errorf("empty key")
+		}
+		for _, c := range self.Value {
+			if !strings.ContainsRune("0123456789abcdef", c) {
+				return nil, fmt.Errorf("invalid hex key %q", self.Value)
+			}
+		}
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown rule type %q", self.Type)
+}
+
+// MAX_TRACKED_IPS bounds the number of IPs whose signature failures are
+// counted, the stalest ones are forgotten first.
+const MAX_TRACKED_IPS = 10000
+
+type AutoBanPolicy struct {
+	// Threshold is the number of signature verification failures within
+	// Window after which the remote IP is banned for Duration. Zero
+	// disables automatic bans.
+	Threshold int
+	Window    time.Duration
+	Duration  time.Duration
+}
+
+type entry struct {
+	rule  Rule
+	ipNet *net.IPNet
+}
+
+// List is a thread safe set of ban rules. If it has a path, every change
+// is persisted to it.
+type List struct {
+	mutex    sync.Mutex
+	path     string
+	entries  []entry
+	policy   AutoBanPolicy
+	failures map[string][]time.Time
+	clock    clock.Clock
+}
+
+func NewList() *List {
+	return &List{
+		failures: make(map[string][]time.Time),
+		clock:    clock.System(),
+	}
+}
+
+// SetClock replaces the system clock used for expiry and auto bans.
+func (l *List) SetClock(c clock.Clock) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.clock = c
+}
+
+// LoadList reads rules from path. A missing file results in an empty list.
+func LoadList(path string) (*List, error) {
+	l := NewList()
+	l.path = path
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reload replaces the rules with the ones stored on disk.
+func (l *List) Reload() error {
+	if l.path == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(l.path)
+	if os.IsNotExist(err) {
+		data, err = []byte("[]"), nil
+	}
+	if err != nil {
+		return err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return fmt.Errorf("malformed ban list %v: %v", l.path, err)
+	}
+	entries := make([]entry, 0, len(rules))
+	for _, r := range rules {
+		ipNet, err := r.normalize()
+		if err != nil {
+			return fmt.Errorf("malformed ban rule %+v: %v", r, err)
+		}
+		entries = append(entries, entry{r, ipNet})
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.entries = entries
+	return nil
+}
+
+func (l *List) SetAutoBanPolicy(policy AutoBanPolicy) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.policy = policy
+}
+
+// Add inserts the rule, replacing the existing rule of the same type and value.
+// The list is left unchanged if the rule can't be persisted.
+func (l *List) Add(rule Rule) error {
+	ipNet, err := rule.normalize()
+	if err != nil {
+		return err
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	old := l.snapshotLocked()
+	l.removeLocked(rule.Type, rule.Value)
+	l.entries = append(l.entries, entry{rule, ipNet})
+	if err := l.saveLocked(); err != nil {
+		l.entries = old
+		return err
+	}
+	return nil
+}
+
+// Remove deletes the rule and returns whether it existed. The list is left
+// unchanged if the removal can't be persisted.
+func (l *List) Remove(typ RuleType, value string) (bool, error) {
+	rule := Rule{Type: typ, Value: value}
+	if _, err := rule.normalize(); err != nil {
+		return false, err
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	old := l.snapshotLocked()
+	if !l.removeLocked(rule.Type, rule.Value) {
+		return false, nil
+	}
+	if err := l.saveLocked(); err != nil {
+		l.entries = old
+		return false, err
+	}
+	return true, nil
+}
+
+// Rules returns all rules which haven't expired yet.
+func (l *List) Rules() []Rule {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.clock.Now()
+	rules := make([]Rule, 0, len(l.entries))
+	for _, e := range l.entries {
+		if !e.rule.expired(now) {
+			rules = append(rules, e.rule)
+		}
+	}
+	return rules
+}
+
+func (l *List) CheckIP(ip net.IP) (Rule, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.clock.Now()
+	for _, e := range l.entries {
+		if e.ipNet != nil && !e.rule.expired(now) && e.ipNet.Contains(ip) {
+			return e.rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+func (l *List) CheckKey(key string) (Rule, bool) {
+	key = strings.ToLower(key)
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.clock.Now()
+	for _, e := range l.entries {
+		if e.rule.Type == RULE_KEY && !e.rule.expired(now) && e.rule.Value == key {
+			return e.rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// RecordSignatureFailure notes a signature verification failure of a peer
+// connecting from ip and bans the ip once the auto ban threshold is reached.
+// Returns whether the ip got banned. Like Add, it leaves the rules unchanged
+// if the ban can't be persisted.
+func (l *List) RecordSignatureFailure(ip net.IP) (bool, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.policy.Threshold <= 0 {
+		return false, nil
+	}
+	now := l.clock.Now()
+	key := ip.String()
+	failures := l.failures[key][:0]
+	for _, ts := range l.failures[key] {
+		if now.Sub(ts) < l.policy.Window {
+			failures = append(failures, ts)
+		}
+	}
+	failures = append(failures, now)
+	if len(failures) < l.policy.Threshold {
+		if _, ok := l.failures[key]; !ok && len(l.failures) >= MAX_TRACKED_IPS {
+			l.evictFailuresLocked(now)
+		}
+		l.failures[key] = failures
+		return false, nil
+	}
+	delete(l.failures, key)
+
+	rule := Rule{
+		Type:   RULE_CIDR,
+		Value:  key,
+		Reason: fmt.Sprintf("%d signature verification failures", len(failures)),
+	}
+	if l.policy.Duration > 0 {
+		rule.Expires = now.Add(l.policy.Duration)
+	}
+	ipNet, err := rule.normalize()
+	if err != nil {
+		return false, err
+	}
+	old := l.snapshotLocked()
+	l.removeLocked(rule.Type, rule.Value)
+	l.entries = append(l.entries, entry{rule, ipNet})
+	if err := l.saveLocked(); err != nil {
+		l.entries = old
+		return false, err
+	}
+	return true, nil
+}
+
+// evictFailuresLocked forgets the IPs without failures in the window and,
+// if none of them are stale, the one failing least recently.
+func (l *List) evictFailuresLocked(now time.Time) {
+	oldestKey := ""
+	var oldest time.Time
+	for key, failures := range l.failures {
+		last := failures[len(failures)-1]
+		if now.Sub(last) >= l.policy.Window {
+			delete(l.failures, key)
+		} else if oldestKey == "" || last.Before(oldest) {
+			oldestKey, oldest = key, last
+		}
+	}
+	if len(l.failures) >= MAX_TRACKED_IPS {
+		delete(l.failures, oldestKey)
+	}
+}
+
+// snapshotLocked copies the entries, so they can be restored after a
+// failed save.
+func (l *List) snapshotLocked() []entry {
+	return append([]entry(nil), l.entries...)
+}
+
+func (l *List) removeLocked(typ RuleType, value string) bool {
+	for idx, e := range l.entries {
+		if e.rule.Type == typ && e.rule.Value == value {
+			l.entries = append(l.entries[:idx], l.entries[idx+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// saveLocked persists the rules dropping the expired ones.
+func (l *List) saveLocked() error {
+	now := l.clock.Now()
+	entries := l.entries[:0]
+	for _, e := range l.entries {
+		if !e.rule.expired(now) {
+			entries = append(entries, e)
+		}
+	}
+	l.entries = entries
+	if l.path == "" {
+		return nil
+	}
+	rules := make([]Rule, len(l.entries))
+	for idx, e := range l.entries {
+		rules[idx] = e.rule
+	}
+	data, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := l.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, l.path)
+}
@@ -0,0 +1,201 @@
+package ban
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golemfactory/bootstrap_go/clock"
+	"github.com/golemfactory/bootstrap_go/peerkeeper"
+	"github.com/golemfactory/bootstrap_go/python"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	l := NewList()
+	require.NoError(t, l.Add(Rule{Type: RULE_CIDR, Value: "10.1.0.0/16"}))
+	require.NoError(t, l.Add(Rule{Type: RULE_CIDR, Value: "2001:db8::1"}))
+	require.NoError(t, l.Add(Rule{Type: RULE_KEY, Value: "DEADBEEF"}))
+	assert.Error(t, l.Add(Rule{Type: RULE_KEY, Value: "xyz"}))
+	assert.Error(t, l.Add(Rule{Type: RULE_CIDR, Value: "10.1.0.0/33"}))
+
+	_, banned := l.CheckIP(net.ParseIP("10.1.2.3"))
+	assert.True(t, banned)
+	_, banned = l.CheckIP(net.ParseIP("10.2.2.3"))
+	assert.False(t, banned)
+	rule, banned := l.CheckIP(net.ParseIP("2001:db8::1"))
+	assert.True(t, banned)
+	assert.Equal(t, "2001:db8::1/128", rule.Value)
+	_, banned = l.CheckKey("deadbeef")
+	assert.True(t, banned)
+
+	removed, err := l.Remove(RULE_KEY, "deadbeef")
+	require.NoError(t, err)
+	assert.True(t, removed)
+	_, banned = l.CheckKey("deadbeef")
+	assert.False(t, banned)
+}
+
+func TestExpiry(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	l := NewList()
+	l.SetClock(c)
+	require.NoError(t, l.Add(Rule{Type: RULE_KEY, Value: "ab", Expires: c.Now().Add(time.Minute)}))
+	_, banned := l.CheckKey("ab")
+	assert.True(t, banned)
+	c.Advance(time.Minute)
+	_, banned = l.CheckKey("ab")
+	assert.False(t, banned)
+	assert.Equal(t, 0, len(l.Rules()))
+}
+
+func TestPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ban")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bans.json")
+
+	l, err := LoadList(path)
+	require.NoError(t, err)
+	require.NoError(t, l.Add(Rule{Type: RULE_CIDR, Value: "1.2.3.4", Reason: "abuse"}))
+
+	l, err = LoadList(path)
+	require.NoError(t, err)
+	rules := l.Rules()
+	require.Equal(t, 1, len(rules))
+	assert.Equal(t, Rule{Type: RULE_CIDR, Value: "1.2.3.4/32", Reason: "abuse"}, rules[0])
+}
+
+func TestSaveFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ban")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	l, err := LoadList(filepath.Join(dir, "missing", "bans.json"))
+	require.NoError(t, err)
+	assert.Error(t, l.Add(Rule{Type: RULE_KEY, Value: "aa"}))
+	_, banned := l.CheckKey("aa")
+	assert.False(t, banned)
+	assert.Equal(t, 0, len(l.Rules()))
+
+	l.SetAutoBanPolicy(AutoBanPolicy{Threshold: 1, Window: time.Minute})
+	ip := net.ParseIP("1.2.3.4")
+	banned, err = l.RecordSignatureFailure(ip)
+	assert.Error(t, err)
+	assert.False(t, banned)
+	_, banned = l.CheckIP(ip)
+	assert.False(t, banned)
+	assert.Equal(t, 0, len(l.Rules()))
+}
+
+func TestAutoBan(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	l := NewList()
+	l.SetClock(c)
+	l.SetAutoBanPolicy(AutoBanPolicy{Threshold: 2, Window: time.Minute, Duration: time.Hour})
+	ip := net.ParseIP("1.2.3.4")
+
+	banned, err := l.RecordSignatureFailure(ip)
+	require.NoError(t, err)
+	assert.False(t, banned)
+	c.Advance(2 * time.Minute)
+	banned, err = l.RecordSignatureFailure(ip)
+	require.NoError(t, err)
+	assert.False(t, banned)
+	banned, err = l.RecordSignatureFailure(ip)
+	require.NoError(t, err)
+	assert.True(t, banned)
+
+	rule, banned := l.CheckIP(ip)
+	assert.True(t, banned)
+	assert.Equal(t, c.Now().Add(time.Hour), rule.Expires)
+}
+
+func TestAutoBanTrackedIPs(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	l := NewList()
+	l.SetClock(c)
+	l.SetAutoBanPolicy(AutoBanPolicy{Threshold: 2, Window: time.Minute, Duration: time.Hour})
+
+	for i := 0; i < MAX_TRACKED_IPS+10; i++ {
+		_, err := l.RecordSignatureFailure(net.IPv4(10, byte(i>>16), byte(i>>8), byte(i)))
+		require.NoError(t, err)
+		c.Advance(time.Millisecond)
+	}
+	assert.Equal(t, MAX_TRACKED_IPS, len(l.failures))
+	_, ok := l.failures["10.0.0.0"]
+	assert.False(t, ok)
+
+	c.Advance(time.Minute)
+	_, err := l.RecordSignatureFailure(net.ParseIP("1.2.3.4"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(l.failures))
+}
+
+func TestHandler(t *testing.T) {
+	l := NewList()
+	server := httptest.NewServer(NewHandler(l))
+	defer server.Close()
+
+	res, err := http.Post(server.URL, "application/json", strings.NewReader(`{"type":"cidr","value":"1.2.3.4"}`))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	var rule Rule
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&rule))
+	assert.Equal(t, "1.2.3.4/32", rule.Value)
+	assert.Equal(t, []Rule{rule}, l.Rules())
+
+	res, err = http.Post(server.URL, "application/json", strings.NewReader(`{"type":"key","value":"xyz"}`))
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestPeerKeeper(t *testing.T) {
+	l := NewList()
+	pk := NewPeerKeeper(peerkeeper.NewRandomizedPeerKeeper(10), l)
+	require.NoError(t, l.Add(Rule{Type: RULE_KEY, Value: "aa"}))
+
+	pk.AddPeer("banned", python.Peer{Address: "1.1.1.1", Node: &python.Node{Key: "aa"}})
+	pk.AddPeer("good", python.Peer{Address: "2.2.2.2", Node: &python.Node{Key: "bb"}})
+	pk.AddPeer("later", python.Peer{Address: "3.3.3.3", Node: &python.Node{Key: "cc"}})
+	require.Equal(t, 2, len(pk.GetPeers("")))
+
+	require.NoError(t, l.Add(Rule{Type: RULE_CIDR, Value: "3.3.3.0/24"}))
+	peers := pk.GetPeers("")
+	require.Equal(t, 1, len(peers))
+	assert.Equal(t, "bb", peers[0].Node.Key)
+}
+
+type sharedPeerKeeper struct {
+	peers []python.Peer
+}
+
+func (self *sharedPeerKeeper) AddPeer(id string, peer python.Peer) {}
+
+func (self *sharedPeerKeeper) GetPeers(id string) []python.Peer {
+	return self.peers
+}
+
+func TestPeerKeeperSharedSlice(t *testing.T) {
+	l := NewList()
+	require.NoError(t, l.Add(Rule{Type: RULE_KEY, Value: "aa"}))
+	inner := &sharedPeerKeeper{peers: []python.Peer{
+		{Address: "1.1.1.1", Node: &python.Node{Key: "aa"}},
+		{Address: "2.2.2.2", Node: &python.Node{Key: "bb"}},
+	}}
+	pk := NewPeerKeeper(inner, l)
+
+	require.Equal(t, 1, len(pk.GetPeers("")))
+	assert.Equal(t, "aa", inner.peers[0].Node.Key)
+	assert.Equal(t, "bb", inner.peers[1].Node.Key)
+}
@@ -0,0 +1,56 @@
+package ban
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// NewHandler returns an admin HTTP handler managing the rules:
+//
+//	GET                          lists the rules
+//	POST {"type":..,"value":..}  adds a rule
+//	DELETE ?type=..&value=..     removes a rule
+func NewHandler(list *List) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, list.Rules())
+		case http.MethodPost:
+			var rule Rule
+			if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			// echo the rule in the form it's stored in
+			if _, err := rule.normalize(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := list.Add(rule); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusCreated, rule)
+		case http.MethodDelete:
+			query := r.URL.Query()
+			removed, err := list.Remove(query.Get("type"), query.Get("value"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if !removed {
+				http.Error(w, "no such rule", http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,55 @@
+package ban
+
+import (
+	"net"
+
+	"github.com/golemfactory/bootstrap_go/peerkeeper"
+	"github.com/golemfactory/bootstrap_go/python"
+)
+
+// PeerKeeper wraps another PeerKeeper making sure banned peers are neither
+// stored nor returned, even if they were banned after being stored.
+type PeerKeeper struct {
+	pk   peerkeeper.PeerKeeper
+	list *List
+}
+
+func NewPeerKeeper(pk peerkeeper.PeerKeeper, list *List) *PeerKeeper {
+	return &PeerKeeper{
+		pk:   pk,
+		list: list,
+	}
+}
+
+func (self *PeerKeeper) AddPeer(id string, peer python.Peer) {
+	if self.isBanned(&peer) {
+		return
+	}
+	self.pk.AddPeer(id, peer)
+}
+
+func (self *PeerKeeper) GetPeers(id string) []python.Peer {
+	peers := self.pk.GetPeers(id)
+	// the slice may be shared by the keeper
+	res := make([]python.Peer, 0, len(peers))
+	for _, p := range peers {
+		if !self.isBanned(&p) {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+func (self *PeerKeeper) isBanned(peer *python.Peer) bool {
+	if peer.Node != nil {
+		if _, banned := self.list.CheckKey(peer.Node.Key); banned {
+			return true
+		}
+	}
+	if ip := net.ParseIP(peer.Address); ip != nil {
+		if _, banned := self.list.CheckIP(ip); banned {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package bootstraptest
+
+import (
+	"net"
+
+	"github.com/golemfactory/bootstrap_go/golemclient"
+	"github.com/golemfactory/bootstrap_go/random"
+)
+
+type Behaviour = golemclient.Behaviour
+
+const (
+	BEHAVIOUR_HONEST         = golemclient.BEHAVIOUR_HONEST
+	BEHAVIOUR_WRONG_RAND_VAL = golemclient.BEHAVIOUR_WRONG_RAND_VAL
+	BEHAVIOUR_BAD_SIGNATURE  = golemclient.BEHAVIOUR_BAD_SIGNATURE
+	BEHAVIOUR_SLOWLORIS      = golemclient.BEHAVIOUR_SLOWLORIS
+	BEHAVIOUR_WRONG_PROTOCOL = golemclient.BEHAVIOUR_WRONG_PROTOCOL
+)
+
+type Result = golemclient.Result
+
+// Client is a simulated Golem node of the harness.
+type Client struct {
+	*golemclient.Client
+}
+
+func NewClient(name string, addr *net.TCPAddr, behaviour Behaviour, r random.Rand) (*Client, error) {
+	c, err := golemclient.NewClient(name, addr, behaviour, r)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{c}, nil
+}
+
+// Bootstrap runs a session with the bootstrap over a link with the given
+// conditions.
+func (c *Client) Bootstrap(b *Bootstrap, link Link) Result {
+	conn, err := b.Listener.Dial(c.Addr, link, c.Rand())
+	if err != nil {
+		return Result{Err: err}
+	}
+	defer conn.Close()
+	return c.Run(conn, b.Config)
+}
@@ -0,0 +1,182 @@
+package bootstraptest
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/golemfactory/bootstrap_go/random"
+)
+
+var errListenerClosed = errors.New("listener closed")
+
+// CLOSE_LINGER is how long a closed connection keeps delivering the
+// buffered data before its end of the pipe is closed.
+const CLOSE_LINGER = time.Second
+
+// Link describes the simulated network between a client and a bootstrap.
+type Link struct {
+	// Latency delays every write.
+	Latency time.Duration
+	// Loss is the probability of the connection being dropped on a write.
+	Loss float64
+}
+
+// Listener is an in-memory net.Listener, connections are made with Dial.
+type Listener struct {
+	addr   *net.TCPAddr
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func NewListener(addr *net.TCPAddr) *Listener {
+	return &Listener{
+		addr:   addr,
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, errListenerClosed
+	}
+}
+
+func (l *Listener) Close() error {
+	l.once.Do(func() {
+		close(l.closed)
+	})
+	return nil
+}
+
+func (l *Listener) Addr() net.Addr {
+	return l.addr
+}
+
+// Dial connects a client from addr, both sides of the connection are
+// subject to the link conditions.
+func (l *Listener) Dial(addr net.Addr, link Link, r random.Rand) (net.Conn, error) {
+	client, server := net.Pipe()
+	clientConn := newLinkConn(client, link, r, addr, l.addr)
+	serverConn := newLinkConn(server, link, r, l.addr, addr)
+	select {
+	case l.conns <- serverConn:
+		return clientConn, nil
+	case <-l.closed:
+		clientConn.Close()
+		serverConn.Close()
+		return nil, errListenerClosed
+	}
+}
+
+type delivery struct {
+	data []byte
+	at   time.Time
+}
+
+// linkConn buffers written data like a TCP socket does, so that both
+// sides may write at once, and delivers it after the link latency.
+type linkConn struct {
+	net.Conn
+	link   Link
+	rand   random.Rand
+	local  net.Addr
+	remote net.Addr
+
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	queue   []delivery
+	closing bool
+	broken  bool
+	// done is closed when the delivering goroutine exits
+	done chan struct{}
+}
+
+func newLinkConn(conn net.Conn, link Link, r random.Rand, local, remote net.Addr) *linkConn {
+	c := &linkConn{
+		Conn:   conn,
+		link:   link,
+		rand:   r,
+		local:  local,
+		remote: remote,
+		done:   make(chan struct{}),
+	}
+	c.cond = sync.NewCond(&c.mutex)
+	go c.deliver()
+	return c
+}
+
+func (c *linkConn) deliver() {
+	defer close(c.done)
+	for {
+		c.mutex.Lock()
+		for len(c.queue) == 0 && !c.closing && !c.broken {
+			c.cond.Wait()
+		}
+		if c.broken || len(c.queue) == 0 {
+			c.mutex.Unlock()
+			c.Conn.Close()
+			return
+		}
+		d := c.queue[0]
+		c.queue = c.queue[1:]
+		c.mutex.Unlock()
+
+		time.Sleep(time.Until(d.at))
+		if _, err := c.Conn.Write(d.data); err != nil {
+			c.mutex.Lock()
+			c.broken = true
+			c.mutex.Unlock()
+		}
+	}
+}
+
+func (c *linkConn) Write(b []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closing || c.broken {
+		return 0, errors.New("write on closed connection")
+	}
+	if c.link.Loss > 0 && c.rand.Float64() < c.link.Loss {
+		c.broken = true
+		c.cond.Signal()
+		return 0, errors.New("connection dropped by the simulated link")
+	}
+	c.queue = append(c.queue, delivery{
+		data: append([]byte(nil), b...),
+		at:   time.Now().Add(c.link.Latency),
+	})
+	c.cond.Signal()
+	return len(b), nil
+}
+
+// Close returns immediately, the buffered data is still delivered for up
+// to CLOSE_LINGER, so the goroutine doesn't block forever on a peer which
+// stopped reading.
+func (c *linkConn) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closing {
+		return nil
+	}
+	c.closing = true
+	c.cond.Signal()
+	time.AfterFunc(CLOSE_LINGER, func() {
+		c.Conn.Close()
+	})
+	return nil
+}
+
+func (c *linkConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *linkConn) RemoteAddr() net.Addr {
+	return c.remote
+}
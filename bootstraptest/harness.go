@@ -0,0 +1,214 @@
+// Package bootstraptest runs bootstrap services and simulated Golem
+// clients in memory, so scenarios like churn, eviction or misbehaving
+// clients can be tested end to end without the network.
+package bootstraptest
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	bootstrap "github.com/golemfactory/bootstrap_go"
+	"github.com/golemfactory/bootstrap_go/crypto"
+	"github.com/golemfactory/bootstrap_go/peerkeeper"
+	"github.com/golemfactory/bootstrap_go/random"
+)
+
+const (
+	PROTO_ID               = "1337"
+	GOLEM_MESSAGES_VERSION = "2.24.3"
+	GOLEM_VERSION          = "0.19.0"
+	BASE_PORT              = 40102
+)
+
+type Options struct {
+	Bootstraps int
+	// Clients are honest, more can be added with Harness.AddClient.
+	Clients int
+	// PeerNum is the capacity of each bootstrap's peer table.
+	PeerNum int
+	// Seed makes the bootstraps' and clients' randomness reproducible.
+	Seed int64
+	Link Link
+	// Configure, if set, adjusts the config of every bootstrap.
+	Configure func(*bootstrap.Config)
+}
+
+// Bootstrap is a bootstrap service served on an in-memory listener.
+type Bootstrap struct {
+	Config     *bootstrap.Config
+	Service    *bootstrap.Service
+	PeerKeeper *peerkeeper.RandomizedPeerKeeper
+	Listener   *Listener
+	serveErr   chan error
+}
+
+type Harness struct {
+	t          testing.TB
+	opts       Options
+	rand       random.Rand
+	Bootstraps []*Bootstrap
+	Clients    []*Client
+}
+
+// New starts the bootstraps and creates the clients, Close has to be
+// called at the end of the test.
+func New(t testing.TB, opts Options) *Harness {
+	if opts.PeerNum == 0 {
+		opts.PeerNum = 100
+	}
+	h := &Harness{
+		t:    t,
+		opts: opts,
+		rand: random.NewSeeded(opts.Seed),
+	}
+	for i := 0; i < opts.Bootstraps; i++ {
+		h.Bootstraps = append(h.Bootstraps, h.startBootstrap(i))
+	}
+	for i := 0; i < opts.Clients; i++ {
+		h.AddClient(BEHAVIOUR_HONEST)
+	}
+	return h
+}
+
+func (h *Harness) startBootstrap(idx int) *Bootstrap {
+	privKey, err := crypto.GeneratePrivateKey()
+	if err != nil {
+		h.t.Fatal("error generating bootstrap key: ", err)
+	}
+	pubKey := privKey.GetPublicKey()
+	addr := &net.TCPAddr{IP: net.IPv4(192, 0, 2, byte(idx+1)), Port: BASE_PORT}
+	config := &bootstrap.Config{
+		Name:                 fmt.Sprintf("bootstrap-%d", idx),
+		Id:                   pubKey.Hex(),
+		Port:                 BASE_PORT,
+		PrvAddr:              addr.IP.String(),
+		PubAddr:              addr.IP.String(),
+		PeerNum:              h.opts.PeerNum,
+		ProtocolId:           PROTO_ID,
+		GolemMessagesVersion: GOLEM_MESSAGES_VERSION,
+		GolemVersion:         GOLEM_VERSION,
+		Rand:                 random.NewSeeded(h.opts.Seed + int64(idx)),
+	}
+	if h.opts.Configure != nil {
+		h.opts.Configure(config)
+	}
+	pk := peerkeeper.NewRandomizedPeerKeeperWithRand(
+		h.opts.PeerNum, random.NewSeeded(h.opts.Seed+int64(idx)))
+	b := &Bootstrap{
+		Config:     config,
+		Service:    bootstrap.NewService(config, privKey, pk),
+		PeerKeeper: pk,
+		Listener:   NewListener(addr),
+		serveErr:   make(chan error, 1),
+	}
+	go func() {
+		b.serveErr <- b.Service.Serve(b.Listener)
+	}()
+	return b
+}
+
+// AddClient creates a client with the next free address, taken from
+// the benchmarking range so bootstraps treat them as public.
+func (h *Harness) AddClient(behaviour Behaviour) *Client {
+	idx := len(h.Clients)
+	addr := &net.TCPAddr{
+		IP:   net.IPv4(198, 18, byte(idx/256), byte(idx%256)),
+		Port: BASE_PORT + 1,
+	}
+	c, err := NewClient(fmt.Sprintf("client-%d", idx), addr, behaviour, h.rand)
+	if err != nil {
+		h.t.Fatal("error creating client: ", err)
+	}
+	h.Clients = append(h.Clients, c)
+	return c
+}
+
+// Connect runs sessions of the clients with the bootstrap concurrently,
+// results are in the order of clients.
+func (h *Harness) Connect(b *Bootstrap, clients ...*Client) []Result {
+	results := make([]Result, len(clients))
+	wg := sync.WaitGroup{}
+	for idx, c := range clients {
+		wg.Add(1)
+		go func(idx int, c *Client) {
+			defer wg.Done()
+			results[idx] = c.Bootstrap(b, h.opts.Link)
+		}(idx, c)
+	}
+	wg.Wait()
+	return results
+}
+
+// ConnectAll connects every client to every bootstrap, the clients of
+// one bootstrap concurrently.
+func (h *Harness) ConnectAll() [][]Result {
+	results := make([][]Result, len(h.Bootstraps))
+	for idx, b := range h.Bootstraps {
+		results[idx] = h.Connect(b, h.Clients...)
+	}
+	return results
+}
+
+// Close stops the bootstraps.
+func (h *Harness) Close() {
+	for _, b := range h.Bootstraps {
+		b.Service.Close()
+		select {
+		case err := <-b.serveErr:
+			if err != nil {
+				h.t.Error("bootstrap serve error: ", err)
+			}
+		case <-time.After(time.Second):
+			h.t.Error("bootstrap didn't stop")
+		}
+	}
+}
+
+// PeerNames returns the sorted node names in the bootstrap's peer table.
+func (b *Bootstrap) PeerNames() []string {
+	peers := b.PeerKeeper.GetPeers("")
+	names := make([]string, len(peers))
+	for idx, p := range peers {
+		names[idx] = p.NodeName
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AssertPeerTable checks the bootstrap stores exactly the given clients.
+func (h *Harness) AssertPeerTable(b *Bootstrap, clients ...*Client) {
+	h.t.Helper()
+	expected := make([]string, len(clients))
+	for idx, c := range clients {
+		expected[idx] = c.Name
+	}
+	sort.Strings(expected)
+	actual := b.PeerNames()
+	if fmt.Sprint(expected) != fmt.Sprint(actual) {
+		h.t.Errorf("%s peer table: expected %v, got %v", b.Config.Name, expected, actual)
+	}
+}
+
+// AssertPeerTableSize checks the number of peers stored by the bootstrap.
+func (h *Harness) AssertPeerTableSize(b *Bootstrap, size int) {
+	h.t.Helper()
+	if actual := len(b.PeerNames()); actual != size {
+		h.t.Errorf("%s peer table: expected %d peers, got %d", b.Config.Name, size, actual)
+	}
+}
+
+// AssertNotStored checks none of the bootstraps stores the client.
+func (h *Harness) AssertNotStored(c *Client) {
+	h.t.Helper()
+	for _, b := range h.Bootstraps {
+		for _, name := range b.PeerNames() {
+			if name == c.Name {
+				h.t.Errorf("%s stores %s", b.Config.Name, c.Name)
+			}
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package bootstraptest
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	bootstrap "github.com/golemfactory/bootstrap_go"
+	"github.com/golemfactory/bootstrap_go/ban"
+	"github.com/golemfactory/bootstrap_go/message"
+	"github.com/golemfactory/bootstrap_go/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHonestClients(t *testing.T) {
+	h := New(t, Options{Bootstraps: 2, Clients: 5})
+	defer h.Close()
+
+	for _, results := range h.ConnectAll() {
+		for _, res := range results {
+			require.NoError(t, res.Err)
+			assert.Equal(t, message.DISCONNECT_BOOTSTRAP, res.DisconnectReason)
+		}
+	}
+	for _, b := range h.Bootstraps {
+		h.AssertPeerTable(b, h.Clients...)
+	}
+
+	// a returning client learns about all the others
+	res := h.Clients[0].Bootstrap(h.Bootstraps[0], Link{})
+	require.NoError(t, res.Err)
+	assert.Equal(t, 4, len(res.Peers))
+	for _, p := range res.Peers {
+		assert.NotEqual(t, h.Clients[0].Name, p.NodeName)
+		assert.Equal(t, p.Node.PubAddr, p.Address)
+	}
+}
+
+// Clients don't wait for the Disconnect of long-lived sessions.
+func TestLongLivedClients(t *testing.T) {
+	h := New(t, Options{Bootstraps: 1, Clients: 3, Configure: func(c *bootstrap.Config) {
+		c.SessionMode = bootstrap.SESSION_MODE_LONG_LIVED
+		c.IdleTimeout = time.Minute
+	}})
+	defer h.Close()
+	b := h.Bootstraps[0]
+	h.Connect(b, h.Clients...)
+	res := h.Clients[0].Bootstrap(b, Link{})
+	require.NoError(t, res.Err)
+	assert.Equal(t, 2, len(res.Peers))
+	h.AssertPeerTable(b, h.Clients...)
+}
+
+func TestEviction(t *testing.T) {
+	h := New(t, Options{Bootstraps: 1, Clients: 10, PeerNum: 4, Seed: 3})
+	defer h.Close()
+	b := h.Bootstraps[0]
+
+	for _, c := range h.Clients {
+		require.NoError(t, c.Bootstrap(b, Link{}).Err)
+	}
+	h.AssertPeerTableSize(b, 4)
+	names := b.PeerNames()
+
+	// the same sequence of sessions evicts the same peers
+	h2 := New(t, Options{Bootstraps: 1, PeerNum: 4, Seed: 3})
+	defer h2.Close()
+	for _, c := range h.Clients {
+		require.NoError(t, c.Bootstrap(h2.Bootstraps[0], Link{}).Err)
+	}
+	assert.Equal(t, names, h2.Bootstraps[0].PeerNames())
+}
+
+func TestChurn(t *testing.T) {
+	h := New(t, Options{Bootstraps: 1, Clients: 3, PeerNum: 3})
+	defer h.Close()
+	b := h.Bootstraps[0]
+	h.Connect(b, h.Clients...)
+	h.AssertPeerTable(b, h.Clients...)
+
+	// a wave of new clients replaces randomly chosen peers, the newest
+	// one is always stored
+	newClients := []*Client{h.AddClient(BEHAVIOUR_HONEST), h.AddClient(BEHAVIOUR_HONEST), h.AddClient(BEHAVIOUR_HONEST)}
+	for _, c := range newClients {
+		res := c.Bootstrap(b, Link{})
+		require.NoError(t, res.Err)
+		assert.Equal(t, 3, len(res.Peers))
+	}
+	h.AssertPeerTableSize(b, 3)
+	assert.Contains(t, b.PeerNames(), newClients[2].Name)
+}
+
+func TestMisbehavingClients(t *testing.T) {
+	h := New(t, Options{Bootstraps: 1, Clients: 2, Configure: func(c *bootstrap.Config) {
+		c.HandshakeTimeout = 3 * time.Second
+	}})
+	defer h.Close()
+	b := h.Bootstraps[0]
+
+	wrongRandVal := h.AddClient(BEHAVIOUR_WRONG_RAND_VAL)
+	badSignature := h.AddClient(BEHAVIOUR_BAD_SIGNATURE)
+	slowloris := h.AddClient(BEHAVIOUR_SLOWLORIS)
+	wrongProtocol := h.AddClient(BEHAVIOUR_WRONG_PROTOCOL)
+	results := h.Connect(b, h.Clients...)
+
+	for _, res := range results[:2] {
+		assert.NoError(t, res.Err)
+	}
+	assert.Error(t, results[2].Err)
+	assert.Equal(t, message.DISCONNECT_UNVERIFIED, results[3].DisconnectReason)
+	assert.Error(t, results[4].Err)
+	assert.Equal(t, message.DISCONNECT_PROTOCOL_VERSION, results[5].DisconnectReason)
+
+	h.AssertPeerTable(b, h.Clients[:2]...)
+	for _, c := range []*Client{wrongRandVal, badSignature, slowloris, wrongProtocol} {
+		h.AssertNotStored(c)
+	}
+}
+
+func TestAutoBan(t *testing.T) {
+	bans := ban.NewList()
+	bans.SetAutoBanPolicy(ban.AutoBanPolicy{Threshold: 2, Window: time.Minute, Duration: time.Hour})
+	h := New(t, Options{Bootstraps: 1, Configure: func(c *bootstrap.Config) {
+		c.Bans = bans
+	}})
+	defer h.Close()
+	b := h.Bootstraps[0]
+
+	attacker := h.AddClient(BEHAVIOUR_BAD_SIGNATURE)
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, message.DISCONNECT_UNVERIFIED, attacker.Bootstrap(b, Link{}).DisconnectReason)
+	}
+	_, banned := bans.CheckIP(attacker.Addr.IP)
+	assert.True(t, banned)
+
+	// switching to an honest key doesn't help from a banned address
+	attacker.Behaviour = BEHAVIOUR_HONEST
+	assert.Error(t, attacker.Bootstrap(b, Link{}).Err)
+	h.AssertNotStored(attacker)
+}
+
+func TestLink(t *testing.T) {
+	h := New(t, Options{Bootstraps: 1, Clients: 2, Link: Link{Latency: 5 * time.Millisecond}})
+	defer h.Close()
+	start := time.Now()
+	for _, res := range h.Connect(h.Bootstraps[0], h.Clients...) {
+		require.NoError(t, res.Err)
+	}
+	// Hellos, RandVals and then Peers take three trips at least
+	assert.True(t, time.Since(start) >= 15*time.Millisecond)
+
+	lossy := New(t, Options{Bootstraps: 1, Clients: 20, Link: Link{Loss: 0.5}})
+	defer lossy.Close()
+	failed := 0
+	for _, res := range lossy.Connect(lossy.Bootstraps[0], lossy.Clients...) {
+		if res.Err != nil {
+			failed++
+		}
+	}
+	assert.True(t, failed > 0)
+	assert.True(t, len(lossy.Bootstraps[0].PeerNames()) < 20)
+}
+
+func TestLinkCloseUnread(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.ParseIP("198.18.0.1"), Port: 40102}
+	l := NewListener(addr)
+	defer l.Close()
+	go l.Accept()
+
+	conn, err := l.Dial(&net.TCPAddr{IP: net.ParseIP("198.18.0.2"), Port: 40102}, Link{}, random.NewSeeded(1))
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("never read"))
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	select {
+	case <-conn.(*linkConn).done:
+	case <-time.After(CLOSE_LINGER + 5*time.Second):
+		t.Fatal("delivering goroutine still blocked after close")
+	}
+}
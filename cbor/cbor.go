@@ -7,6 +7,9 @@ import (
 	impl "github.com/whyrusleeping/cbor/go"
 )
 
+// Serialize sorts map keys too, but neither by the RFC 8949 rules nor like
+// Python, and doesn't always use the shortest integers. The signed message
+// payloads use SerializeCanonical.
 func Serialize(obj interface{}) ([]byte, error) {
 	var b bytes.Buffer
 	writer := bufio.NewWriter(&b)
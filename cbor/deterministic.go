@@ -0,0 +1,247 @@
+package cbor
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	majorUint   = 0 << 5
+	majorNegint = 1 << 5
+	majorBytes  = 2 << 5
+	majorText   = 3 << 5
+	majorArray  = 4 << 5
+	majorMap    = 5 << 5
+	majorSimple = 7 << 5
+)
+
+const (
+	simpleFalse   = majorSimple | 20
+	simpleTrue    = majorSimple | 21
+	simpleNull    = majorSimple | 22
+	simpleFloat16 = majorSimple | 25
+	simpleFloat32 = majorSimple | 26
+	simpleFloat64 = majorSimple | 27
+)
+
+// KeyOrder is the order of the encoded map keys.
+type KeyOrder int
+
+const (
+	// KEY_ORDER_BYTEWISE sorts the keys by the bytewise order of their
+	// encoding, as RFC 8949 section 4.2.1 requires.
+	KEY_ORDER_BYTEWISE KeyOrder = iota
+	// KEY_ORDER_LENGTH_FIRST sorts shorter encoded keys first and keys of
+	// the same length bytewise, as the canonical CBOR of RFC 7049 section
+	// 3.9 and Python cbor2 with canonical=True do.
+	KEY_ORDER_LENGTH_FIRST
+)
+
+// SerializeDeterministic encodes obj following the core deterministic
+// encoding requirements of RFC 8949 section 4.2.1, so equal values always
+// produce the same bytes, whatever the map iteration order:
+//   - integers, lengths and floats take their shortest form preserving
+//     the value, NaN is encoded as 0xf97e00,
+//   - map keys are sorted by the bytewise order of their encoding,
+//   - only definite lengths are used.
+//
+// Structs are encoded as maps the same way Serialize does.
+func SerializeDeterministic(obj interface{}) ([]byte, error) {
+	return (&encoder{KEY_ORDER_BYTEWISE}).append(nil, reflect.ValueOf(obj))
+}
+
+// SerializeCanonical encodes obj like SerializeDeterministic but with
+// the map keys in KEY_ORDER_LENGTH_FIRST, the order Python's
+// cbor2.dumps(obj, canonical=True) uses. It's the encoding of the signed
+// message payloads.
+func SerializeCanonical(obj interface{}) ([]byte, error) {
+	return (&encoder{KEY_ORDER_LENGTH_FIRST}).append(nil, reflect.ValueOf(obj))
+}
+
+type encoder struct {
+	order KeyOrder
+}
+
+func (self *encoder) append(dst []byte, v reflect.Value) ([]byte, error) {
+	if !v.IsValid() {
+		return append(dst, simpleNull), nil
+	}
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return append(dst, simpleNull), nil
+		}
+		return self.append(dst, v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			return append(dst, simpleTrue), nil
+		}
+		return append(dst, simpleFalse), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i := v.Int(); i < 0 {
+			return appendHead(dst, majorNegint, uint64(-1-i)), nil
+		}
+		return appendHead(dst, majorUint, uint64(v.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return appendHead(dst, majorUint, v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return appendFloat(dst, v.Float()), nil
+	case reflect.String:
+		dst = appendHead(dst, majorText, uint64(v.Len()))
+		return append(dst, v.String()...), nil
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			dst = appendHead(dst, majorBytes, uint64(v.Len()))
+			if v.Kind() == reflect.Slice {
+				return append(dst, v.Bytes()...), nil
+			}
+			for i := 0; i < v.Len(); i++ {
+				dst = append(dst, byte(v.Index(i).Uint()))
+			}
+			return dst, nil
+		}
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return append(dst, simpleNull), nil
+		}
+		dst = appendHead(dst, majorArray, uint64(v.Len()))
+		var err error
+		for i := 0; i < v.Len(); i++ {
+			if dst, err = self.append(dst, v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return dst, nil
+	case reflect.Map:
+		entries := make([]mapEntry, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			key, err := self.append(nil, k)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, mapEntry{key, v.MapIndex(k)})
+		}
+		return self.appendMap(dst, entries)
+	case reflect.Struct:
+		entries := []mapEntry{}
+		for i := 0; i < v.NumField(); i++ {
+			name, ok := fieldName(v.Type().Field(i))
+			if !ok {
+				continue
+			}
+			key := appendHead(nil, majorText, uint64(len(name)))
+			entries = append(entries, mapEntry{append(key, name...), v.Field(i)})
+		}
+		return self.appendMap(dst, entries)
+	}
+	return nil, fmt.Errorf("can't CBOR encode %v", v.Type())
+}
+
+type mapEntry struct {
+	key   []byte
+	value reflect.Value
+}
+
+func (self *encoder) appendMap(dst []byte, entries []mapEntry) ([]byte, error) {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].key, entries[j].key
+		if self.order == KEY_ORDER_LENGTH_FIRST && len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return bytes.Compare(a, b) < 0
+	})
+	dst = appendHead(dst, majorMap, uint64(len(entries)))
+	var err error
+	for idx, e := range entries {
+		if idx > 0 && bytes.Equal(e.key, entries[idx-1].key) {
+			return nil, fmt.Errorf("duplicate map key %x", e.key)
+		}
+		dst = append(dst, e.key...)
+		if dst, err = self.append(dst, e.value); err != nil {
+			return nil, err
+		}
+	}
+	return dst, nil
+}
+
+// fieldName follows the rules of the Serialize encoder, the cbor tag
+// takes precedence over the json one.
+func fieldName(field reflect.StructField) (string, bool) {
+	if field.PkgPath != "" {
+		return "", false
+	}
+	tag, ok := field.Tag.Lookup("cbor")
+	if !ok {
+		tag, ok = field.Tag.Lookup("json")
+	}
+	if !ok {
+		return field.Name, true
+	}
+	name := strings.Split(tag, ",")[0]
+	switch name {
+	case "":
+		return field.Name, true
+	case "-":
+		return "", false
+	}
+	return name, true
+}
+
+// appendHead appends the initial byte with the shortest argument.
+func appendHead(dst []byte, major byte, arg uint64) []byte {
+	switch {
+	case arg < 24:
+		return append(dst, major|byte(arg))
+	case arg <= math.MaxUint8:
+		return append(dst, major|24, byte(arg))
+	case arg <= math.MaxUint16:
+		return append(dst, major|25, byte(arg>>8), byte(arg))
+	case arg <= math.MaxUint32:
+		return append(dst, major|26, byte(arg>>24), byte(arg>>16), byte(arg>>8), byte(arg))
+	}
+	return append(dst, major|27, byte(arg>>56), byte(arg>>48), byte(arg>>40), byte(arg>>32),
+		byte(arg>>24), byte(arg>>16), byte(arg>>8), byte(arg))
+}
+
+func appendFloat(dst []byte, f float64) []byte {
+	if math.IsNaN(f) {
+		return append(dst, simpleFloat16, 0x7e, 0x00)
+	}
+	if f32 := float32(f); float64(f32) == f {
+		if h, ok := float16Bits(f32); ok {
+			return append(dst, simpleFloat16, byte(h>>8), byte(h))
+		}
+		b := math.Float32bits(f32)
+		return append(dst, simpleFloat32, byte(b>>24), byte(b>>16), byte(b>>8), byte(b))
+	}
+	b := math.Float64bits(f)
+	return append(dst, simpleFloat64, byte(b>>56), byte(b>>48), byte(b>>40), byte(b>>32),
+		byte(b>>24), byte(b>>16), byte(b>>8), byte(b))
+}
+
+// float16Bits returns the half precision encoding of f if it's exact.
+func float16Bits(f float32) (uint16, bool) {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int(bits>>23&0xff) - 127
+	mant := bits & 0x7fffff
+	switch {
+	case exp == 128:
+		// infinity, NaN is handled by the caller
+		return sign | 0x7c00, mant == 0
+	case exp == -127:
+		// zero, single precision subnormals are too small
+		return sign, mant == 0
+	case exp >= -14 && exp <= 15:
+		return sign | uint16(exp+15)<<10 | uint16(mant>>13), mant&0x1fff == 0
+	case exp >= -24 && exp < -14:
+		// half precision subnormal, a multiple of 2^-24
+		full := 0x800000 | mant
+		shift := uint(-exp - 1)
+		return sign | uint16(full>>shift), full&(1<<shift-1) == 0
+	}
+	return 0, false
+}
@@ -0,0 +1,162 @@
+package cbor
+
+import (
+	"encoding/hex"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Examples from RFC 8949 appendix A.
+func TestDeterministicVectors(t *testing.T) {
+	vectors := []struct {
+		value interface{}
+		hex   string
+	}{
+		{uint64(0), "00"},
+		{uint64(23), "17"},
+		{uint64(24), "1818"},
+		{uint64(255), "18ff"},
+		{uint64(256), "190100"},
+		{uint64(65535), "19ffff"},
+		{uint64(1000000), "1a000f4240"},
+		{uint64(1000000000000), "1b000000e8d4a51000"},
+		{uint64(math.MaxUint64), "1bffffffffffffffff"},
+		{-1, "20"},
+		{-1000, "3903e7"},
+		{int64(math.MinInt64), "3b7fffffffffffffff"},
+		{0.0, "f90000"},
+		{math.Copysign(0, -1), "f98000"},
+		{1.0, "f93c00"},
+		{1.1, "fb3ff199999999999a"},
+		{1.5, "f93e00"},
+		{65504.0, "f97bff"},
+		{100000.0, "fa47c35000"},
+		{3.4028234663852886e+38, "fa7f7fffff"},
+		{1.0e+300, "fb7e37e43c8800759c"},
+		{5.960464477539063e-8, "f90001"},
+		{0.00006103515625, "f90400"},
+		{-4.0, "f9c400"},
+		{-4.1, "fbc010666666666666"},
+		{math.Inf(1), "f97c00"},
+		{math.NaN(), "f97e00"},
+		{math.Inf(-1), "f9fc00"},
+		{float32(0.5), "f93800"},
+		{false, "f4"},
+		{true, "f5"},
+		{nil, "f6"},
+		{"", "60"},
+		{"a", "6161"},
+		{"IETF", "6449455446"},
+		{[]byte{1, 2, 3, 4}, "4401020304"},
+		{[]interface{}{}, "80"},
+		{[]interface{}{uint64(1), []interface{}{uint64(2), uint64(3)}}, "8201820203"},
+		{map[interface{}]interface{}{}, "a0"},
+		{map[interface{}]interface{}{uint64(3): uint64(4), uint64(1): uint64(2)}, "a201020304"},
+		{map[string]interface{}{"b": []int{2, 3}, "a": 1}, "a26161016162820203"},
+	}
+	for _, v := range vectors {
+		b, err := SerializeDeterministic(v.value)
+		require.NoError(t, err)
+		assert.Equal(t, v.hex, hex.EncodeToString(b), "%#v", v.value)
+		// the key orders agree for these
+		b, err = SerializeCanonical(v.value)
+		require.NoError(t, err)
+		assert.Equal(t, v.hex, hex.EncodeToString(b), "%#v", v.value)
+	}
+}
+
+func TestDeterministicKeyOrder(t *testing.T) {
+	m := map[interface{}]interface{}{
+		"aa":        nil,
+		"b":         nil,
+		"a":         nil,
+		uint64(100): nil,
+		int64(-1):   nil,
+		uint64(10):  nil,
+	}
+	b, err := SerializeDeterministic(m)
+	require.NoError(t, err)
+	// 10, 100, -1, "a", "b", "aa" by the bytewise order of the encoded keys
+	assert.Equal(t, "a6"+"0af6"+"1864f6"+"20f6"+"6161f6"+"6162f6"+"626161f6", hex.EncodeToString(b))
+}
+
+// The example of RFC 7049 section 3.9.
+func TestCanonicalKeyOrder(t *testing.T) {
+	m := map[interface{}]interface{}{
+		uint64(10):  nil,
+		uint64(100): nil,
+		int64(-1):   nil,
+		"z":         nil,
+		"aa":        nil,
+		false:       nil,
+	}
+	b, err := SerializeCanonical(m)
+	require.NoError(t, err)
+	// 10, -1, false, 100, "z", "aa" by length, then bytewise
+	assert.Equal(t, "a6"+"0af6"+"20f6"+"f4f6"+"1864f6"+"617af6"+"626161f6", hex.EncodeToString(b))
+
+	_, err = SerializeCanonical(map[interface{}]interface{}{int64(1): "a", uint64(1): "b"})
+	assert.Error(t, err)
+}
+
+func TestDeterministicStable(t *testing.T) {
+	build := func(reverse bool) map[interface{}]interface{} {
+		m := make(map[interface{}]interface{})
+		for i := 0; i < 100; i++ {
+			k := i
+			if reverse {
+				k = 99 - i
+			}
+			m[string(rune('a'+k%26))+hex.EncodeToString([]byte{byte(k)})] = map[interface{}]interface{}{
+				"port": uint64(k), "key": []byte{byte(k)}, "rand": float64(k) / 3,
+			}
+		}
+		return m
+	}
+	expected, err := SerializeDeterministic(build(false))
+	require.NoError(t, err)
+	for i := 0; i < 50; i++ {
+		b, err := SerializeDeterministic(build(i%2 == 1))
+		require.NoError(t, err)
+		require.Equal(t, expected, b)
+	}
+
+	var decoded map[interface{}]interface{}
+	require.NoError(t, Deserialize(expected, &decoded))
+	assert.Len(t, decoded, 100)
+}
+
+func TestDeterministicStruct(t *testing.T) {
+	type data struct {
+		Zeta    uint64
+		Alpha   string `json:"alpha,omitempty"`
+		Skipped int    `cbor:"-"`
+		private int
+	}
+	b, err := SerializeDeterministic(data{Zeta: 1, Alpha: "x", Skipped: 2, private: 3})
+	require.NoError(t, err)
+	assert.Equal(t, "a2"+"645a65746101"+"65616c7068616178", hex.EncodeToString(b))
+}
+
+func TestDeterministicDuplicateKey(t *testing.T) {
+	_, err := SerializeDeterministic(map[interface{}]interface{}{int64(1): "a", uint64(1): "b"})
+	assert.Error(t, err)
+}
+
+func TestDeterministicRoundTrip(t *testing.T) {
+	value := []interface{}{
+		uint64(40102), int64(-7), 0.25, "node", []byte{0xde, 0xad},
+		map[interface{}]interface{}{"key": "deadbeef", "nat": []interface{}{"Full Cone"}},
+		true, nil,
+	}
+	b, err := SerializeDeterministic(value)
+	require.NoError(t, err)
+	var decoded interface{}
+	require.NoError(t, Deserialize(b, &decoded))
+	again, err := SerializeDeterministic(decoded)
+	require.NoError(t, err)
+	assert.Equal(t, b, again)
+}
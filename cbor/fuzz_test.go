@@ -0,0 +1,74 @@
+//go:build go1.18
+// +build go1.18
+
+package cbor
+
+import (
+	"testing"
+)
+
+var fuzzOptions = &DecodeOptions{MaxDepth: 4, MaxCollectionLen: 8, MaxBytes: 512, DisallowedTags: []uint64{2, 3, 4, 5}}
+
+// valueShape returns the nesting depth and the longest collection of v.
+func valueShape(v interface{}) (depth int, maxLen int) {
+	children := []interface{}{}
+	switch x := v.(type) {
+	case []interface{}:
+		children = x
+	case map[interface{}]interface{}:
+		for k, v := range x {
+			children = append(children, k, v)
+		}
+		maxLen = len(x)
+	default:
+		return 0, 0
+	}
+	if _, ok := v.([]interface{}); ok {
+		maxLen = len(children)
+	}
+	for _, c := range children {
+		d, l := valueShape(c)
+		if d > depth {
+			depth = d
+		}
+		if l > maxLen {
+			maxLen = l
+		}
+	}
+	return depth + 1, maxLen
+}
+
+func FuzzDeserializeWithOptions(f *testing.F) {
+	seeds := []interface{}{
+		[]interface{}{[]interface{}{"port", uint64(40102)}, []interface{}{"rand_val", 0.5}},
+		map[interface{}]interface{}{"node": map[interface{}]interface{}{"key": "deadbeef"}},
+		[]interface{}{[]byte{1, 2}, int64(-1), nil, true},
+	}
+	for _, s := range seeds {
+		b, err := SerializeDeterministic(s)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+	f.Add(nestedLists(10))
+	f.Add([]byte{0x9b, 0, 0, 0, 1, 0, 0, 0, 0})
+	f.Add([]byte{0xbf, 1, 1, 0xff})
+	f.Add([]byte{0x5f, 0x41, 0, 0xff})
+	// a map key decoded into a map used to panic
+	f.Add([]byte("\xa1\xa1000"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var v interface{}
+		if err := DeserializeWithOptions(data, &v, fuzzOptions); err != nil {
+			return
+		}
+		depth, maxLen := valueShape(v)
+		if depth > fuzzOptions.MaxDepth {
+			t.Fatalf("decoded depth %d exceeds the limit", depth)
+		}
+		if maxLen > fuzzOptions.MaxCollectionLen {
+			t.Fatalf("decoded collection of %d exceeds the limit", maxLen)
+		}
+	})
+}
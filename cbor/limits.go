@@ -0,0 +1,235 @@
+package cbor
+
+import (
+	"bytes"
+	"fmt"
+
+	impl "github.com/whyrusleeping/cbor/go"
+)
+
+const (
+	DEFAULT_MAX_DEPTH          = 32
+	DEFAULT_MAX_COLLECTION_LEN = 1 << 16
+	DEFAULT_MAX_BYTES          = 4 << 20
+)
+
+// DecodeOptions limits the resources used to decode untrusted input.
+// Zero values disable the respective limits.
+type DecodeOptions struct {
+	// MaxDepth limits the nesting of arrays, maps and tags.
+	MaxDepth int
+	// MaxCollectionLen limits the number of array elements and map pairs.
+	MaxCollectionLen int
+	// MaxBytes limits the size of the input.
+	MaxBytes int
+	// DisallowedTags are rejected wherever they appear.
+	DisallowedTags []uint64
+}
+
+// DefaultDecodeOptions are the limits used for message payloads. Bignums
+// and decimal fractions are disallowed, the decoder can't represent them.
+func DefaultDecodeOptions() *DecodeOptions {
+	return &DecodeOptions{
+		MaxDepth:         DEFAULT_MAX_DEPTH,
+		MaxCollectionLen: DEFAULT_MAX_COLLECTION_LEN,
+		MaxBytes:         DEFAULT_MAX_BYTES,
+		DisallowedTags:   []uint64{2, 3, 4, 5},
+	}
+}
+
+// DeserializeWithOptions is Deserialize checking the input against opts
+// first, so it never allocates for collections or strings longer than the
+// input itself. The input must hold exactly one data item. A nil opts
+// only checks the well-formedness.
+func DeserializeWithOptions(input []byte, obj interface{}, opts *DecodeOptions) error {
+	if opts == nil {
+		opts = &DecodeOptions{}
+	}
+	if opts.MaxBytes > 0 && len(input) > opts.MaxBytes {
+		return fmt.Errorf("cbor: input of %d bytes exceeds the limit of %d", len(input), opts.MaxBytes)
+	}
+	c := &checker{input: input, opts: opts}
+	if err := c.item(0, false); err != nil {
+		return err
+	}
+	if c.pos != len(input) {
+		return fmt.Errorf("cbor: %d bytes of trailing data", len(input)-c.pos)
+	}
+	return decode(input, obj)
+}
+
+// decode turns panics of the decoder on input the checker doesn't catch
+// into errors.
+func decode(input []byte, obj interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("cbor: decoding failed: %v", r)
+		}
+	}()
+	return impl.NewDecoder(bytes.NewReader(input)).Decode(obj)
+}
+
+// checker walks the encoded items without decoding them.
+type checker struct {
+	input []byte
+	pos   int
+	opts  *DecodeOptions
+}
+
+const (
+	infoIndefinite = 31
+	breakCode      = 0xff
+)
+
+func (self *checker) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("cbor: "+format+" at offset %d", append(args, self.pos)...)
+}
+
+func (self *checker) remaining() uint64 {
+	return uint64(len(self.input) - self.pos)
+}
+
+// head reads the initial byte and the argument following it.
+func (self *checker) head() (major byte, info byte, arg uint64, err error) {
+	if self.remaining() == 0 {
+		return 0, 0, 0, self.errorf("unexpected end of input")
+	}
+	b := self.input[self.pos]
+	major, info = b>>5, b&0x1f
+	self.pos++
+	var size int
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info == infoIndefinite:
+		return major, info, 0, nil
+	case info > 27:
+		return 0, 0, 0, self.errorf("reserved additional information %d", info)
+	default:
+		size = 1 << (info - 24)
+	}
+	if self.remaining() < uint64(size) {
+		return 0, 0, 0, self.errorf("unexpected end of input")
+	}
+	for _, b := range self.input[self.pos : self.pos+size] {
+		arg = arg<<8 | uint64(b)
+	}
+	self.pos += size
+	return major, info, arg, nil
+}
+
+func (self *checker) collectionLen(n uint64) error {
+	if max := self.opts.MaxCollectionLen; max > 0 && n > uint64(max) {
+		return self.errorf("collection of %d elements exceeds the limit of %d", n, max)
+	}
+	return nil
+}
+
+func (self *checker) nested(depth int) error {
+	if max := self.opts.MaxDepth; max > 0 && depth >= max {
+		return self.errorf("nesting exceeds the limit of %d", max)
+	}
+	return nil
+}
+
+// item checks a single data item, key is set for map keys, which can't
+// be collections as Go maps don't accept them as keys.
+func (self *checker) item(depth int, key bool) error {
+	major, info, arg, err := self.head()
+	if err != nil {
+		return err
+	}
+	if key && (major == 4 || major == 5) {
+		return self.errorf("unsupported map key of major type %d", major)
+	}
+	indefinite := info == infoIndefinite
+	switch major {
+	case 0, 1:
+		if indefinite {
+			return self.errorf("indefinite length integer")
+		}
+	case 2, 3:
+		if indefinite {
+			return self.chunks(major)
+		}
+		if arg > self.remaining() {
+			return self.errorf("string of %d bytes exceeds the input", arg)
+		}
+		self.pos += int(arg)
+	case 4, 5:
+		if err := self.nested(depth); err != nil {
+			return err
+		}
+		perElem := 1
+		if major == 5 {
+			perElem = 2
+		}
+		if indefinite {
+			for n := uint64(0); ; n++ {
+				if self.remaining() > 0 && self.input[self.pos] == breakCode {
+					self.pos++
+					return nil
+				}
+				if err := self.collectionLen(n + 1); err != nil {
+					return err
+				}
+				for i := 0; i < perElem; i++ {
+					if err := self.item(depth+1, major == 5 && i == 0); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		if err := self.collectionLen(arg); err != nil {
+			return err
+		}
+		// every element takes at least a byte
+		if arg > self.remaining()/uint64(perElem) {
+			return self.errorf("collection of %d elements exceeds the input", arg)
+		}
+		for n := uint64(0); n < arg*uint64(perElem); n++ {
+			if err := self.item(depth+1, major == 5 && n%2 == 0); err != nil {
+				return err
+			}
+		}
+	case 6:
+		if indefinite {
+			return self.errorf("indefinite length tag")
+		}
+		for _, tag := range self.opts.DisallowedTags {
+			if tag == arg {
+				return self.errorf("disallowed tag %d", arg)
+			}
+		}
+		if err := self.nested(depth); err != nil {
+			return err
+		}
+		return self.item(depth+1, false)
+	case 7:
+		if indefinite {
+			return self.errorf("unexpected break")
+		}
+	}
+	return nil
+}
+
+// chunks checks the definite length chunks of an indefinite length string.
+func (self *checker) chunks(major byte) error {
+	for {
+		if self.remaining() > 0 && self.input[self.pos] == breakCode {
+			self.pos++
+			return nil
+		}
+		chunkMajor, info, arg, err := self.head()
+		if err != nil {
+			return err
+		}
+		if chunkMajor != major || info == infoIndefinite {
+			return self.errorf("invalid chunk of an indefinite length string")
+		}
+		if arg > self.remaining() {
+			return self.errorf("string of %d bytes exceeds the input", arg)
+		}
+		self.pos += int(arg)
+	}
+}
@@ -0,0 +1,102 @@
+package cbor
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func nestedLists(depth int) []byte {
+	b := []byte{}
+	for i := 0; i < depth; i++ {
+		b = append(b, 0x81)
+	}
+	return append(b, 0x00)
+}
+
+func TestDecodeLimits(t *testing.T) {
+	opts := &DecodeOptions{MaxDepth: 3, MaxCollectionLen: 4, MaxBytes: 64, DisallowedTags: []uint64{2}}
+	var v interface{}
+
+	require.NoError(t, DeserializeWithOptions(nestedLists(3), &v, opts))
+	err := DeserializeWithOptions(nestedLists(4), &v, opts)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "nesting exceeds the limit of 3")
+
+	list, err := SerializeDeterministic([]int{1, 2, 3, 4, 5})
+	require.NoError(t, err)
+	err = DeserializeWithOptions(list, &v, opts)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "collection of 5 elements exceeds the limit of 4")
+
+	// indefinite length map of 5 pairs
+	err = DeserializeWithOptions([]byte{0xbf, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 0xff}, &v, opts)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeds the limit of 4")
+
+	long, err := SerializeDeterministic(strings.Repeat("a", 100))
+	require.NoError(t, err)
+	err = DeserializeWithOptions(long, &v, opts)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeds the limit of 64")
+
+	// bignum
+	err = DeserializeWithOptions([]byte{0xc2, 0x41, 0x01}, &v, opts)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "disallowed tag 2")
+}
+
+func TestDecodeDeclaredLengths(t *testing.T) {
+	for _, h := range []string{
+		// array of 2^32 elements
+		"9b0000000100000000",
+		// map of 2^32 pairs
+		"bb0000000100000000",
+		// 2^62 bytes long string
+		"5b4000000000000000",
+		"7b4000000000000000",
+		// truncated
+		"8301",
+		"19ff",
+		// reserved additional information
+		"1c",
+		// trailing data
+		"0000",
+		// stray break
+		"ff",
+		// chunk of another major type
+		"5f6161ff",
+		// collections as map keys
+		"a1a1303030",
+		"a1bf3030ff30",
+		"a1810030",
+	} {
+		b, err := hex.DecodeString(h)
+		require.NoError(t, err)
+		var v interface{}
+		assert.Error(t, DeserializeWithOptions(b, &v, nil), h)
+	}
+}
+
+func TestDecodeWithinLimits(t *testing.T) {
+	value := map[interface{}]interface{}{
+		"peers": []interface{}{
+			map[interface{}]interface{}{"address": "10.0.0.1", "port": uint64(40102)},
+		},
+		"chunked": "ab",
+	}
+	b, err := SerializeDeterministic(value)
+	require.NoError(t, err)
+	var v interface{}
+	require.NoError(t, DeserializeWithOptions(b, &v, DefaultDecodeOptions()))
+	assert.Equal(t, value, v)
+
+	// indefinite length text and array
+	require.NoError(t, DeserializeWithOptions([]byte{0x7f, 0x61, 'a', 0x61, 'b', 0xff}, &v, DefaultDecodeOptions()))
+	assert.Equal(t, "ab", v)
+	require.NoError(t, DeserializeWithOptions([]byte{0x9f, 0x01, 0x02, 0xff}, &v, DefaultDecodeOptions()))
+	assert.Equal(t, []interface{}{uint64(1), uint64(2)}, v)
+}
@@ -44,6 +44,22 @@ func PublicKeyFromBytes(b []byte) (key PublicKey, err error) {
 	return
 }
 
+// PrivateKeyFromBytes creates a key from its raw 32 byte secret.
+func PrivateKeyFromBytes(b []byte) (key PrivateKey, err error) {
+	if len(b) != 32 {
+		err = fmt.Errorf("private key should be 32 bytes long, got %d", len(b))
+		return
+	}
+	curve := secp256k1.S256()
+	key.key = &ecies.PrivateKey{
+		D: new(big.Int).SetBytes(b),
+	}
+	key.key.PublicKey.X, key.key.PublicKey.Y = curve.ScalarBaseMult(b)
+	key.key.PublicKey.Curve = curve
+	key.key.PublicKey.Params = ecies.ParamsFromCurve(curve)
+	return
+}
+
 func GeneratePrivateKey() (key PrivateKey, err error) {
 	key.key, err = ecies.GenerateKey(rand.Reader, secp256k1.S256(), nil)
 	return
@@ -43,6 +43,22 @@ func TestPublicKeyHex(t *testing.T) {
 	assert.Equal(t, 128, len(key.Hex()))
 }
 
+func TestPrivateKeyFromBytes(t *testing.T) {
+	key, err := GeneratePrivateKey()
+	require.NoError(t, err)
+	secret := make([]byte, 32)
+	d := key.key.D.Bytes()
+	copy(secret[32-len(d):], d)
+	restored, err := PrivateKeyFromBytes(secret)
+	require.NoError(t, err)
+	pubKey := key.GetPublicKey()
+	restoredPubKey := restored.GetPublicKey()
+	assert.Equal(t, pubKey.Hex(), restoredPubKey.Hex())
+
+	_, err = PrivateKeyFromBytes([]byte{1, 2, 3})
+	assert.Error(t, err)
+}
+
 func benchmarkDifficultKeyGeneration(b *testing.B, difficulty uint) {
 	for n := 0; n < b.N; n++ {
 		GenerateDifficultKey(difficulty)
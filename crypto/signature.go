@@ -1,17 +1,31 @@
 package crypto
 
 import (
+	"math/big"
+
 	"github.com/ethereum/go-ethereum/crypto/secp256k1"
 )
 
 func (self *PrivateKey) Sign(data []byte) ([]byte, error) {
-	return secp256k1.Sign(data, self.key.D.Bytes())
+	return secp256k1.Sign(data, paddedBytes(self.key.D, 32))
 }
 
 func (self *PublicKey) VerifySign(data []byte, signature []byte) bool {
 	pubKeyBytes := make([]byte, 0, 65)
 	pubKeyBytes = append(pubKeyBytes, 0x4)
-	pubKeyBytes = append(pubKeyBytes, self.key.X.Bytes()...)
-	pubKeyBytes = append(pubKeyBytes, self.key.Y.Bytes()...)
+	pubKeyBytes = append(pubKeyBytes, paddedBytes(self.key.X, 32)...)
+	pubKeyBytes = append(pubKeyBytes, paddedBytes(self.key.Y, 32)...)
 	return secp256k1.VerifySignature(pubKeyBytes, data, signature[:64])
 }
+
+// paddedBytes returns the big-endian representation of n left padded
+// with zeros to size bytes, as expected by secp256k1.
+func paddedBytes(n *big.Int, size int) []byte {
+	b := n.Bytes()
+	if len(b) >= size {
+		return b
+	}
+	res := make([]byte, size)
+	copy(res[size-len(b):], b)
+	return res
+}
@@ -1,6 +1,7 @@
 package crypto
 
 import (
+	"math/big"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -16,3 +17,8 @@ func TestSignature(t *testing.T) {
 	ok := pub.VerifySign(data, sig)
 	assert.True(t, ok)
 }
+
+func TestPaddedBytes(t *testing.T) {
+	assert.Equal(t, []byte{0, 0, 1, 2}, paddedBytes(new(big.Int).SetBytes([]byte{1, 2}), 4))
+	assert.Equal(t, []byte{1, 2}, paddedBytes(new(big.Int).SetBytes([]byte{1, 2}), 2))
+}
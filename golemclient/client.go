@@ -0,0 +1,300 @@
+// Package golemclient plays the Golem node's side of a bootstrap session,
+// honestly or misbehaving, e.g. for the in-memory harness of bootstraptest
+// and for load tests.
+package golemclient
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"time"
+
+	bootstrap "github.com/golemfactory/bootstrap_go"
+	"github.com/golemfactory/bootstrap_go/crypto"
+	"github.com/golemfactory/bootstrap_go/message"
+	"github.com/golemfactory/bootstrap_go/python"
+	"github.com/golemfactory/bootstrap_go/random"
+)
+
+type Behaviour int
+
+const (
+	BEHAVIOUR_HONEST Behaviour = iota
+	// BEHAVIOUR_WRONG_RAND_VAL echoes a different RandVal than received.
+	BEHAVIOUR_WRONG_RAND_VAL
+	// BEHAVIOUR_BAD_SIGNATURE signs its messages with a key other than
+	// the declared one.
+	BEHAVIOUR_BAD_SIGNATURE
+	// BEHAVIOUR_SLOWLORIS sends its Hello one byte per SLOWLORIS_DELAY.
+	BEHAVIOUR_SLOWLORIS
+	// BEHAVIOUR_WRONG_PROTOCOL declares a protocol ID of another network.
+	BEHAVIOUR_WRONG_PROTOCOL
+)
+
+const SLOWLORIS_DELAY = 50 * time.Millisecond
+
+// Client is a simulated Golem node.
+type Client struct {
+	Name string
+	// Addr is advertised in the Hello, the local address of the
+	// connection is used if it's nil.
+	Addr      *net.TCPAddr
+	Behaviour Behaviour
+	privKey   crypto.PrivateKey
+	// otherKey signs the messages of BEHAVIOUR_BAD_SIGNATURE clients.
+	otherKey crypto.PrivateKey
+	rand     random.Rand
+}
+
+// Result is the outcome of a client's session with a bootstrap.
+type Result struct {
+	Peers []python.Peer
+	// DisconnectReason is the reason sent by the bootstrap, empty if
+	// the session ended otherwise.
+	DisconnectReason message.DisconnectReason
+	Err              error
+	// Handshake is the time from the start of the session until
+	// the bootstrap's RandVal was received, zero if it wasn't.
+	Handshake time.Duration
+}
+
+func NewClient(name string, addr *net.TCPAddr, behaviour Behaviour, r random.Rand) (*Client, error) {
+	privKey, err := crypto.GeneratePrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	otherKey, err := crypto.GeneratePrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		Name:      name,
+		Addr:      addr,
+		Behaviour: behaviour,
+		privKey:   privKey,
+		otherKey:  otherKey,
+		rand:      r,
+	}, nil
+}
+
+// Key is the hex encoded public key of the client.
+func (c *Client) Key() string {
+	pubKey := c.privKey.GetPublicKey()
+	return pubKey.Hex()
+}
+
+// Rand is the source of the client's RandVals.
+func (c *Client) Rand() random.Rand {
+	return c.rand
+}
+
+// Run runs a session over an established connection, e.g. to a remote
+// bootstrap. Only the protocol ID, versions and session mode of config
+// are used, in SESSION_MODE_LONG_LIVED the client disconnects itself
+// after receiving the peers.
+func (c *Client) Run(conn net.Conn, config *bootstrap.Config) Result {
+	s := &clientSession{client: c, conn: conn}
+	return s.run(config)
+}
+
+type clientSession struct {
+	client    *Client
+	conn      net.Conn
+	serverKey *crypto.PublicKey
+}
+
+func (s *clientSession) run(config *bootstrap.Config) (res Result) {
+	c := s.client
+	start := time.Now()
+	msg, err := s.receive()
+	if err != nil {
+		return Result{Err: err}
+	}
+	serverHello, ok := msg.(*message.Hello)
+	if !ok {
+		return Result{Err: fmt.Errorf("expected Hello, got type %d", msg.GetType())}
+	}
+	serverNode, err := python.DictToNode(serverHello.NodeInfo)
+	if err != nil {
+		return Result{Err: err}
+	}
+	serverKey, err := publicKey(serverNode.Key)
+	if err != nil {
+		return Result{Err: err}
+	}
+	s.serverKey = &serverKey
+
+	protoId := config.ProtocolId
+	if c.Behaviour == BEHAVIOUR_WRONG_PROTOCOL {
+		protoId += "-other"
+	}
+	addr := c.Addr
+	if addr == nil {
+		local, ok := s.conn.LocalAddr().(*net.TCPAddr)
+		if !ok {
+			return Result{Err: fmt.Errorf("no address to advertise")}
+		}
+		addr = local
+	}
+	node := python.Node{
+		NodeName: c.Name,
+		Key:      c.Key(),
+		PubAddr:  addr.IP.String(),
+		PubPort:  uint64(addr.Port),
+		PrvAddr:  addr.IP.String(),
+		PrvPort:  uint64(addr.Port),
+	}
+	hello := &message.Hello{
+		Port:                 uint64(addr.Port),
+		NodeName:             c.Name,
+		ClientKeyId:          c.Key(),
+		NodeInfo:             node.ToDict(),
+		RandVal:              c.rand.Float64(),
+		Metadata:             make(map[string]interface{}),
+		ProtoId:              protoId,
+		ClientVer:            config.GolemVersion,
+		GolemMessagesVersion: config.GolemMessagesVersion,
+	}
+	if c.Behaviour == BEHAVIOUR_SLOWLORIS {
+		err = s.sendSlowly(hello)
+	} else {
+		err = s.send(hello)
+	}
+	if err != nil {
+		return Result{Err: err}
+	}
+
+	randVal := serverHello.RandVal
+	if c.Behaviour == BEHAVIOUR_WRONG_RAND_VAL {
+		randVal += 1
+	}
+	if err := s.send(&message.RandVal{RandVal: randVal}); err != nil {
+		return s.result(err)
+	}
+
+	msg, err = s.receive()
+	if err != nil {
+		return s.result(err)
+	}
+	serverRandVal, ok := msg.(*message.RandVal)
+	if !ok {
+		return s.unexpected(msg)
+	}
+	if serverRandVal.RandVal != hello.RandVal {
+		return Result{Err: fmt.Errorf("incorrect RandVal from bootstrap")}
+	}
+	res.Handshake = time.Since(start)
+
+	msg, err = s.receive()
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	peersMsg, ok := msg.(*message.Peers)
+	if !ok {
+		unexpected := s.unexpected(msg)
+		unexpected.Handshake = res.Handshake
+		return unexpected
+	}
+	for _, p := range peersMsg.Peers {
+		m, err := message.DecodeMap(p)
+		if err != nil {
+			res.Err = fmt.Errorf("malformed peer: %v", err)
+			return res
+		}
+		peer, err := python.DictToPeer(m)
+		if err != nil {
+			res.Err = fmt.Errorf("malformed peer: %v", err)
+			return res
+		}
+		res.Peers = append(res.Peers, *peer)
+	}
+	if config.SessionMode == bootstrap.SESSION_MODE_LONG_LIVED {
+		// the bootstrap waits for requests until it times out
+		res.Err = s.send(&message.Disconnect{Reason: message.DISCONNECT_BOOTSTRAP})
+		return res
+	}
+
+	msg, err = s.receive()
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	if disconnect, ok := msg.(*message.Disconnect); ok {
+		res.DisconnectReason = disconnect.Reason
+	} else {
+		res.Err = fmt.Errorf("expected Disconnect, got type %d", msg.GetType())
+	}
+	return res
+}
+
+// result turns a failure into the Disconnect reason if the bootstrap
+// sent one before closing the connection.
+func (s *clientSession) result(err error) Result {
+	msg, recvErr := s.receive()
+	if recvErr == nil {
+		if disconnect, ok := msg.(*message.Disconnect); ok {
+			return Result{DisconnectReason: disconnect.Reason, Err: err}
+		}
+	}
+	return Result{Err: err}
+}
+
+func (s *clientSession) unexpected(msg message.Message) Result {
+	if disconnect, ok := msg.(*message.Disconnect); ok {
+		return Result{DisconnectReason: disconnect.Reason}
+	}
+	return Result{Err: fmt.Errorf("unexpected message type %d", msg.GetType())}
+}
+
+func (s *clientSession) sign(shortHash []byte) ([]byte, error) {
+	key := s.client.privKey
+	if s.client.Behaviour == BEHAVIOUR_BAD_SIGNATURE {
+		key = s.client.otherKey
+	}
+	return key.Sign(message.ShortHashSha(shortHash))
+}
+
+func (s *clientSession) encrypt(data []byte) ([]byte, error) {
+	return crypto.Encrypt(data, *s.serverKey)
+}
+
+func (s *clientSession) send(msg message.Message) error {
+	return message.Send(s.conn, msg, s.encrypt, s.sign)
+}
+
+func (s *clientSession) sendSlowly(msg message.Message) error {
+	frame, err := message.Serialize(msg, s.encrypt, s.sign)
+	if err != nil {
+		return err
+	}
+	lenBuf := make([]byte, 4)
+	binary.BigEndian.PutUint32(lenBuf, uint32(len(frame)))
+	for _, b := range append(lenBuf, frame...) {
+		time.Sleep(SLOWLORIS_DELAY)
+		if _, err := s.conn.Write([]byte{b}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *clientSession) receive() (message.Message, error) {
+	verifySign := func(shortHash []byte, sig []byte) bool {
+		// the bootstrap's Hello carries the key it's signed with
+		if s.serverKey == nil {
+			return true
+		}
+		return s.serverKey.VerifySign(message.ShortHashSha(shortHash), sig)
+	}
+	return message.Receive(s.conn, s.client.privKey.Decrypt, verifySign, nil)
+}
+
+func publicKey(keyHex string) (crypto.PublicKey, error) {
+	b, err := hex.DecodeString(keyHex)
+	if err != nil {
+		return crypto.PublicKey{}, err
+	}
+	return crypto.PublicKeyFromBytes(append([]byte{0x04}, b...))
+}
@@ -0,0 +1,124 @@
+package bootstrap
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/golemfactory/bootstrap_go/message"
+	"github.com/golemfactory/bootstrap_go/python"
+)
+
+// HandlerFunc handles a message received in a long-lived session.
+// Returning an error terminates the session.
+type HandlerFunc func(session *PeerSession, msg message.Message) error
+
+// Hooks are optional callbacks invoked along the session lifecycle.
+// Any of them may be nil.
+type Hooks struct {
+	// OnConnect is called for every accepted connection before the
+	// handshake, returning an error rejects the connection.
+	OnConnect func(conn net.Conn) error
+	// OnHandshakeComplete is called once the peer is verified.
+	OnHandshakeComplete func(session *PeerSession, peer python.Peer)
+	// OnMessage is called for every message received from the peer,
+	// returning an error terminates the session.
+	OnMessage func(session *PeerSession, msg message.Message) error
+	// OnDisconnect is called when the session ends. The reason is the one
+	// of the Disconnect message sent or received, empty if there was none.
+	OnDisconnect func(session *PeerSession, reason message.DisconnectReason)
+	// AllowAddPeer can veto storing the peer in the PeerKeeper, it gets
+	// the sanitized record.
+	AllowAddPeer func(id string, peer python.Peer) bool
+	// OnPeerDecision is called with the outcome of storing the peer.
+	OnPeerDecision func(session *PeerSession, decision PeerDecision)
+}
+
+// Handle registers the handler of the given message type, replacing the
+// previous one. Handlers should be registered before Listen.
+func (s *Service) Handle(typ uint16, handler HandlerFunc) error {
+	if !message.IsRegistered(typ) {
+		return fmt.Errorf("unsupported msg type %d", typ)
+	}
+	if typ == message.MSG_DISCONNECT_TYPE {
+		return fmt.Errorf("Disconnect is handled by the session")
+	}
+	s.handlers[typ] = handler
+	return nil
+}
+
+// Use appends hooks to the chain, they are invoked in the registration
+// order. Hooks should be registered before Listen.
+func (s *Service) Use(hooks Hooks) {
+	s.hooks = append(s.hooks, hooks)
+}
+
+func (s *Service) registerDefaultHandlers() {
+	s.handlers[message.MSG_GET_PEERS_TYPE] = func(session *PeerSession, msg message.Message) error {
+		return session.SendPeers()
+	}
+	s.handlers[message.MSG_PING_TYPE] = func(session *PeerSession, msg message.Message) error {
+		return session.Send(&message.Pong{})
+	}
+}
+
+func (s *Service) onConnect(conn net.Conn) error {
+	for _, h := range s.hooks {
+		if h.OnConnect != nil {
+			if err := h.OnConnect(conn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Service) onHandshakeComplete(session *PeerSession) {
+	for _, h := range s.hooks {
+		if h.OnHandshakeComplete != nil {
+			h.OnHandshakeComplete(session, session.peer)
+		}
+	}
+}
+
+func (s *Service) onMessage(session *PeerSession, msg message.Message) error {
+	for _, h := range s.hooks {
+		if h.OnMessage != nil {
+			if err := h.OnMessage(session, msg); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Service) onDisconnect(session *PeerSession) {
+	for _, h := range s.hooks {
+		if h.OnDisconnect != nil {
+			h.OnDisconnect(session, session.disconnectReason)
+		}
+	}
+}
+
+// addPeer stores the sanitized peer unless it's rejected by sanitizePeer
+// or vetoed by a hook.
+func (s *Service) addPeer(n *Network, id string, peer python.Peer) PeerDecision {
+	peer, decision := s.sanitizePeer(peer)
+	if !decision.Stored {
+		return decision
+	}
+	for _, h := range s.hooks {
+		if h.AllowAddPeer != nil && !h.AllowAddPeer(id, peer) {
+			return PeerDecision{Reason: PEER_VETOED, Detail: "rejected by a hook"}
+		}
+	}
+	n.PeerKeeper.AddPeer(id, peer)
+	return decision
+}
+
+func (s *Service) onPeerDecision(session *PeerSession, decision PeerDecision) {
+	for _, h := range s.hooks {
+		if h.OnPeerDecision != nil {
+			h.OnPeerDecision(session, decision)
+		}
+	}
+}
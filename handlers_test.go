@@ -0,0 +1,76 @@
+package bootstrap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golemfactory/bootstrap_go/message"
+	"github.com/golemfactory/bootstrap_go/python"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleUnsupportedType(t *testing.T) {
+	service := getService(t, getConfig(), NewTestPeerKeeper())
+	assert.Error(t, service.Handle(31337, nil))
+	assert.Error(t, service.Handle(message.MSG_DISCONNECT_TYPE, nil))
+}
+
+func testHandlersImpl(t *testing.T, handleCh chan error) {
+	const CLIENT_ID = "client-id"
+
+	pk := NewTestPeerKeeper()
+	config := getConfig()
+	config.SessionMode = SESSION_MODE_LONG_LIVED
+	config.IdleTimeout = time.Second
+	service := getService(t, config, pk)
+
+	var handshakePeer *python.Peer
+	var received []uint16
+	disconnectCh := make(chan message.DisconnectReason, 1)
+	service.Use(Hooks{
+		OnHandshakeComplete: func(session *PeerSession, peer python.Peer) {
+			handshakePeer = &peer
+		},
+		OnMessage: func(session *PeerSession, msg message.Message) error {
+			received = append(received, msg.GetType())
+			return nil
+		},
+		OnDisconnect: func(session *PeerSession, reason message.DisconnectReason) {
+			disconnectCh <- reason
+		},
+		AllowAddPeer: func(id string, peer python.Peer) bool {
+			return false
+		},
+	})
+	err := service.Handle(message.MSG_FIND_NODE_TYPE, func(session *PeerSession, msg message.Message) error {
+		assert.Equal(t, "wanted", msg.(*message.FindNode).NodeKeyId)
+		return session.Disconnect(message.DISCONNECT_BOOTSTRAP)
+	})
+	require.NoError(t, err)
+
+	client := startSession(t, service, handleCh)
+	client.handshake(CLIENT_ID)
+
+	_, ok := client.receive().(*message.Peers)
+	require.True(t, ok)
+	client.send(&message.FindNode{NodeKeyId: "wanted"})
+	disconnect := client.receive().(*message.Disconnect)
+	assert.Equal(t, message.DISCONNECT_BOOTSTRAP, disconnect.Reason)
+
+	assert.NoError(t, <-handleCh)
+	assert.Equal(t, message.DISCONNECT_BOOTSTRAP, <-disconnectCh)
+	require.NotNil(t, handshakePeer)
+	clientPubKey := client.privKey.GetPublicKey()
+	assert.Equal(t, clientPubKey.Hex(), handshakePeer.Node.Key)
+	assert.Equal(t, []uint16{
+		message.MSG_HELLO_TYPE,
+		message.MSG_RAND_VAL_TYPE,
+		message.MSG_FIND_NODE_TYPE,
+	}, received)
+	assert.Equal(t, 0, len(pk.AddPeerCalls))
+}
+
+func TestHandlers(t *testing.T) {
+	runSessionTest(t, testHandlersImpl)
+}
@@ -0,0 +1,207 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	LEVEL_DEBUG Level = iota
+	LEVEL_INFO
+	LEVEL_WARN
+	LEVEL_ERROR
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LEVEL_DEBUG || l > LEVEL_ERROR {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+func ParseLevel(s string) (Level, error) {
+	for idx, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(idx), nil
+		}
+	}
+	return LEVEL_INFO, fmt.Errorf("unknown log level %q", s)
+}
+
+// Logger is a leveled, structured logger. Fields are passed as alternating
+// keys and values. Implementations should be thread safe.
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+	// With returns a logger which adds given fields to every entry.
+	With(keyvals ...interface{}) Logger
+}
+
+type formatFunc = func(buf *bytes.Buffer, ts time.Time, level Level, msg string, keyvals []interface{})
+
+type logger struct {
+	out    io.Writer
+	mutex  *sync.Mutex
+	level  Level
+	format formatFunc
+	fields []interface{}
+}
+
+// NewJSONLogger creates a logger writing one JSON object per line.
+func NewJSONLogger(out io.Writer, level Level) Logger {
+	return newLogger(out, level, formatJSON)
+}
+
+// NewTextLogger creates a logger writing human readable logfmt-like lines.
+func NewTextLogger(out io.Writer, level Level) Logger {
+	return newLogger(out, level, formatText)
+}
+
+func NewLogger(out io.Writer, level Level, format string) (Logger, error) {
+	switch format {
+	case "json":
+		return NewJSONLogger(out, level), nil
+	case "text":
+		return NewTextLogger(out, level), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", format)
+}
+
+func newLogger(out io.Writer, level Level, format formatFunc) *logger {
+	return &logger{
+		out:    out,
+		mutex:  &sync.Mutex{},
+		level:  level,
+		format: format,
+	}
+}
+
+func (l *logger) Debug(msg string, keyvals ...interface{}) {
+	l.log(LEVEL_DEBUG, msg, keyvals)
+}
+
+func (l *logger) Info(msg string, keyvals ...interface{}) {
+	l.log(LEVEL_INFO, msg, keyvals)
+}
+
+func (l *logger) Warn(msg string, keyvals ...interface{}) {
+	l.log(LEVEL_WARN, msg, keyvals)
+}
+
+func (l *logger) Error(msg string, keyvals ...interface{}) {
+	l.log(LEVEL_ERROR, msg, keyvals)
+}
+
+func (l *logger) With(keyvals ...interface{}) Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keyvals))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyvals...)
+	return &logger{
+		out:    l.out,
+		mutex:  l.mutex,
+		level:  l.level,
+		format: l.format,
+		fields: fields,
+	}
+}
+
+func (l *logger) log(level Level, msg string, keyvals []interface{}) {
+	if level < l.level {
+		return
+	}
+	all := make([]interface{}, 0, len(l.fields)+len(keyvals))
+	all = append(all, l.fields...)
+	all = append(all, keyvals...)
+	if len(all)%2 != 0 {
+		all = append(all, "(MISSING)")
+	}
+	var buf bytes.Buffer
+	l.format(&buf, time.Now(), level, msg, all)
+	buf.WriteByte('\n')
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.out.Write(buf.Bytes())
+}
+
+func formatJSON(buf *bytes.Buffer, ts time.Time, level Level, msg string, keyvals []interface{}) {
+	buf.WriteString(`{"time":`)
+	writeJSON(buf, ts.UTC().Format(time.RFC3339Nano))
+	buf.WriteString(`,"level":`)
+	writeJSON(buf, level.String())
+	buf.WriteString(`,"msg":`)
+	writeJSON(buf, msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		buf.WriteByte(',')
+		writeJSON(buf, fmt.Sprint(keyvals[i]))
+		buf.WriteByte(':')
+		writeJSON(buf, jsonValue(keyvals[i+1]))
+	}
+	buf.WriteByte('}')
+}
+
+func jsonValue(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case error:
+		return vv.Error()
+	case fmt.Stringer:
+		return vv.String()
+	}
+	return v
+}
+
+func writeJSON(buf *bytes.Buffer, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprintf("%+v", v))
+	}
+	buf.Write(b)
+}
+
+func formatText(buf *bytes.Buffer, ts time.Time, level Level, msg string, keyvals []interface{}) {
+	buf.WriteString(ts.Format(time.RFC3339))
+	buf.WriteByte(' ')
+	buf.WriteString(strings.ToUpper(level.String()))
+	buf.WriteByte(' ')
+	buf.WriteString(msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		buf.WriteByte(' ')
+		buf.WriteString(fmt.Sprint(keyvals[i]))
+		buf.WriteByte('=')
+		writeTextValue(buf, keyvals[i+1])
+	}
+}
+
+func writeTextValue(buf *bytes.Buffer, v interface{}) {
+	s := fmt.Sprintf("%+v", v)
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		s = fmt.Sprintf("%q", s)
+	}
+	buf.WriteString(s)
+}
+
+type nopLogger struct{}
+
+// NewNopLogger returns a logger which discards everything.
+func NewNopLogger() Logger {
+	return nopLogger{}
+}
+
+func (nopLogger) Debug(msg string, keyvals ...interface{}) {}
+func (nopLogger) Info(msg string, keyvals ...interface{})  {}
+func (nopLogger) Warn(msg string, keyvals ...interface{})  {}
+func (nopLogger) Error(msg string, keyvals ...interface{}) {}
+
+func (l nopLogger) With(keyvals ...interface{}) Logger {
+	return l
+}
@@ -0,0 +1,44 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONLogger(t *testing.T) {
+	var b bytes.Buffer
+	log := NewJSONLogger(&b, LEVEL_INFO).With("session", 7)
+	log.Debug("hidden")
+	log.Info("hello", "err", errors.New("boom"), "port", 40102)
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	require.Equal(t, 1, len(lines))
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "info", entry["level"])
+	assert.Equal(t, "hello", entry["msg"])
+	assert.Equal(t, float64(7), entry["session"])
+	assert.Equal(t, "boom", entry["err"])
+	assert.Equal(t, float64(40102), entry["port"])
+}
+
+func TestTextLogger(t *testing.T) {
+	var b bytes.Buffer
+	log := NewTextLogger(&b, LEVEL_DEBUG)
+	log.With("remote_addr", "1.2.3.4:5").Warn("session error", "err", "read failed")
+	assert.Contains(t, b.String(), ` WARN session error remote_addr=1.2.3.4:5 err="read failed"`)
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("WARN")
+	require.NoError(t, err)
+	assert.Equal(t, LEVEL_WARN, level)
+	_, err = ParseLevel("verbose")
+	assert.Error(t, err)
+}
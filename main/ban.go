@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golemfactory/bootstrap_go/ban"
+)
+
+const BAN_USAGE = `usage: %s ban <command> [flags]
+
+Edits the persisted ban list. A running bootstrap reloads it on SIGHUP.
+
+commands:
+  list    print the active rules
+  add     add a rule, requires -cidr or -key
+  remove  remove a rule, requires -cidr or -key
+`
+
+func runBan(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, BAN_USAGE, os.Args[0])
+		return fmt.Errorf("missing ban command")
+	}
+	cmd := args[0]
+	flags := flag.NewFlagSet("ban "+cmd, flag.ExitOnError)
+	var path string
+	var cidr string
+	var key string
+	var reason string
+	var expiresIn time.Duration
+	flags.StringVar(&path, "ban-file", BAN_FILE, "Path of the ban list")
+	flags.StringVar(&cidr, "cidr", "", "Banned IP or CIDR")
+	flags.StringVar(&key, "key", "", "Banned node key (hex)")
+	flags.StringVar(&reason, "reason", "", "Reason of the ban")
+	flags.DurationVar(&expiresIn, "expires-in", 0, "Duration of the ban, permanent if 0")
+	flags.Parse(args[1:])
+
+	list, err := ban.LoadList(path)
+	if err != nil {
+		return err
+	}
+
+	rule := ban.Rule{Reason: reason}
+	switch {
+	case cidr != "" && key != "":
+		return fmt.Errorf("-cidr and -key are mutually exclusive")
+	case cidr != "":
+		rule.Type, rule.Value = ban.RULE_CIDR, cidr
+	case key != "":
+		rule.Type, rule.Value = ban.RULE_KEY, key
+	}
+
+	switch cmd {
+	case "list":
+		for _, r := range list.Rules() {
+			expires := "never"
+			if !r.Expires.IsZero() {
+				expires = r.Expires.Format(time.RFC3339)
+			}
+			fmt.Printf("%s\t%s\texpires: %s\t%s\n", r.Type, r.Value, expires, r.Reason)
+		}
+		return nil
+	case "add":
+		if rule.Type == "" {
+			return fmt.Errorf("-cidr or -key is required")
+		}
+		if expiresIn > 0 {
+			rule.Expires = time.Now().Add(expiresIn)
+		}
+		return list.Add(rule)
+	case "remove":
+		if rule.Type == "" {
+			return fmt.Errorf("-cidr or -key is required")
+		}
+		removed, err := list.Remove(rule.Type, rule.Value)
+		if err != nil {
+			return err
+		}
+		if !removed {
+			return fmt.Errorf("no such rule")
+		}
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, BAN_USAGE, os.Args[0])
+	return fmt.Errorf("unknown ban command %q", cmd)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bootstrap "github.com/golemfactory/bootstrap_go"
+	"github.com/golemfactory/bootstrap_go/golemclient"
+	"github.com/golemfactory/bootstrap_go/message"
+	"github.com/golemfactory/bootstrap_go/random"
+)
+
+const LOADGEN_USAGE = `usage: %s loadgen -target host:port [flags]
+
+Runs full client sessions against a bootstrap and reports handshake
+latency percentiles, throughput and errors.
+
+`
+
+type loadgenStats struct {
+	mutex      sync.Mutex
+	handshakes []time.Duration
+	sessions   int
+	errors     map[string]int
+}
+
+func (s *loadgenStats) record(res golemclient.Result, dialErr error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sessions++
+	if res.Handshake > 0 {
+		s.handshakes = append(s.handshakes, res.Handshake)
+	}
+	if category := errorCategory(res, dialErr); category != "" {
+		s.errors[category]++
+	}
+}
+
+// errorCategory groups errors by their kind, dropping the details like
+// addresses which would make every error unique.
+func errorCategory(res golemclient.Result, dialErr error) string {
+	if dialErr != nil {
+		if ne, ok := dialErr.(net.Error); ok && ne.Timeout() {
+			return "dial: timeout"
+		}
+		return "dial"
+	}
+	if res.DisconnectReason != "" && res.DisconnectReason != message.DISCONNECT_BOOTSTRAP {
+		return "disconnect: " + string(res.DisconnectReason)
+	}
+	if res.Err == nil {
+		return ""
+	}
+	if ne, ok := res.Err.(net.Error); ok && ne.Timeout() {
+		return "timeout"
+	}
+	msg := res.Err.Error()
+	if idx := strings.Index(msg, ":"); idx >= 0 {
+		msg = msg[:idx]
+	}
+	return msg
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted)-1) * p)
+	return sorted[idx]
+}
+
+func runLoadgen(args []string) error {
+	flags := flag.NewFlagSet("loadgen", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, LOADGEN_USAGE, os.Args[0])
+		flags.PrintDefaults()
+	}
+	var target string
+	var concurrency int
+	var sessions int
+	var duration time.Duration
+	var keys int
+	var timeout time.Duration
+	var protocolId string
+	var golemMessagesVersion string
+	var golemVersion string
+	var clientAddr string
+	var longLived bool
+	flags.StringVar(&target, "target", "", "Address of the bootstrap")
+	flags.IntVar(&concurrency, "concurrency", 10, "Number of concurrent sessions")
+	flags.IntVar(&sessions, "sessions", 1000, "Total number of sessions, unlimited if 0")
+	flags.DurationVar(&duration, "duration", 0, "Stop after this time, unlimited if 0")
+	flags.IntVar(&keys, "keys", 100, "Number of pre-generated client keys")
+	flags.DurationVar(&timeout, "timeout", 10*time.Second, "Timeout of a single session")
+	flags.StringVar(&protocolId, "protocol-id", PROTO_ID+"-testnet", "Protocol ID of the target network")
+	flags.StringVar(&golemMessagesVersion, "golem-messages", GOLEM_MESSAGES_VERSION, "Declared golem-messages version")
+	flags.StringVar(&golemVersion, "golem-version", GOLEM_VERSION, "Declared Golem version")
+	flags.StringVar(&clientAddr, "client-addr", "", "host:port advertised by the clients, the local address of each connection if empty")
+	flags.BoolVar(&longLived, "long-lived", false, "The target runs long-lived sessions, clients disconnect after receiving the peers")
+	flags.Parse(args)
+	if target == "" {
+		flags.Usage()
+		return fmt.Errorf("missing -target")
+	}
+	if concurrency <= 0 || keys <= 0 {
+		return fmt.Errorf("-concurrency and -keys have to be positive")
+	}
+	if sessions == 0 && duration == 0 {
+		return fmt.Errorf("either -sessions or -duration has to be set")
+	}
+
+	var addr *net.TCPAddr
+	if clientAddr != "" {
+		var err error
+		addr, err = net.ResolveTCPAddr("tcp", clientAddr)
+		if err != nil {
+			return fmt.Errorf("invalid -client-addr: %v", err)
+		}
+	}
+
+	config := &bootstrap.Config{
+		ProtocolId:           protocolId,
+		GolemMessagesVersion: golemMessagesVersion,
+		GolemVersion:         golemVersion,
+	}
+	if longLived {
+		config.SessionMode = bootstrap.SESSION_MODE_LONG_LIVED
+	}
+	fmt.Fprintf(os.Stderr, "generating %d keys\n", keys)
+	clients := make([]*golemclient.Client, keys)
+	for i := range clients {
+		c, err := golemclient.NewClient(fmt.Sprintf("loadgen-%d", i), addr, golemclient.BEHAVIOUR_HONEST, random.Secure())
+		if err != nil {
+			return err
+		}
+		clients[i] = c
+	}
+
+	// jobs carries client indexes, it's closed when the run is over
+	jobs := make(chan int)
+	stop := make(chan struct{})
+	if duration > 0 {
+		time.AfterFunc(duration, func() { close(stop) })
+	}
+	go func() {
+		defer close(jobs)
+		for i := 0; sessions == 0 || i < sessions; i++ {
+			select {
+			case jobs <- i % keys:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	stats := &loadgenStats{errors: make(map[string]int)}
+	start := time.Now()
+	wg := sync.WaitGroup{}
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				conn, err := net.DialTimeout("tcp", target, timeout)
+				if err != nil {
+					stats.record(golemclient.Result{}, err)
+					continue
+				}
+				// bounds the whole session, whatever the target does
+				if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+					conn.Close()
+					stats.record(golemclient.Result{Err: err}, nil)
+					continue
+				}
+				res := clients[idx].Run(conn, config)
+				conn.Close()
+				stats.record(res, nil)
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	sort.Slice(stats.handshakes, func(i, j int) bool {
+		return stats.handshakes[i] < stats.handshakes[j]
+	})
+	failed := 0
+	for _, n := range stats.errors {
+		failed += n
+	}
+	fmt.Printf("sessions:    %d (%d failed) in %v\n", stats.sessions, failed, elapsed.Round(time.Millisecond))
+	fmt.Printf("throughput:  %.1f sessions/s, %.1f handshakes/s\n",
+		float64(stats.sessions)/elapsed.Seconds(),
+		float64(len(stats.handshakes))/elapsed.Seconds())
+	fmt.Printf("handshake:   p50 %v, p95 %v, p99 %v\n",
+		percentile(stats.handshakes, 0.50).Round(time.Microsecond),
+		percentile(stats.handshakes, 0.95).Round(time.Microsecond),
+		percentile(stats.handshakes, 0.99).Round(time.Microsecond))
+	categories := make([]string, 0, len(stats.errors))
+	for c := range stats.errors {
+		categories = append(categories, c)
+	}
+	sort.Strings(categories)
+	for _, c := range categories {
+		fmt.Printf("error:       %s: %d\n", c, stats.errors[c])
+	}
+	return nil
+}
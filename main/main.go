@@ -3,12 +3,22 @@ package main
 import (
 	"flag"
 	"fmt"
-	"log"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	bootstrap "github.com/golemfactory/bootstrap_go"
+	"github.com/golemfactory/bootstrap_go/ban"
 	"github.com/golemfactory/bootstrap_go/crypto"
+	"github.com/golemfactory/bootstrap_go/logging"
+	"github.com/golemfactory/bootstrap_go/message"
 	"github.com/golemfactory/bootstrap_go/peerkeeper"
+	"github.com/golemfactory/bootstrap_go/proxyproto"
+	"github.com/golemfactory/bootstrap_go/semver"
 
 	"github.com/ccding/go-stun/stun"
 )
@@ -21,9 +31,25 @@ const (
 	GOLEM_MESSAGES_VERSION = "2.24.3"
 	GOLEM_VERSION          = "0.19.0"
 	KEY_DIFF               = 14
+	BAN_FILE               = "bans.json"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "ban" {
+		if err := runBan(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "loadgen" {
+		if err := runLoadgen(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var port uint64
 	var peerNum int
 	var name string
@@ -31,6 +57,25 @@ func main() {
 	var golemMessagesVersion string
 	var golemVersion string
 	var mainnet bool
+	var logLevel string
+	var logFormat string
+	var acceptedGolemMessages string
+	var acceptedGolemVersions string
+	var longLived bool
+	var allowReserved bool
+	var sendPeerRecords bool
+	var idleTimeout time.Duration
+	var writeTimeout time.Duration
+	var maxClockSkew time.Duration
+	var banFile string
+	var adminAddr string
+	var adminAllowRemote bool
+	var autoBanThreshold int
+	var autoBanWindow time.Duration
+	var autoBanDuration time.Duration
+	var extraNetworks string
+	var listenAddrs string
+	var proxyTrusted string
 	flag.Uint64Var(&port, "port", PORT, "Port to listen to")
 	flag.IntVar(&peerNum, "peer-num", PEER_NUM, "Number of peers to send")
 	flag.StringVar(&name, "name", NAME, "Name of the node")
@@ -38,36 +83,109 @@ func main() {
 	flag.StringVar(&golemMessagesVersion, "golem-messages", GOLEM_MESSAGES_VERSION, "Version of the golem-messages library")
 	flag.StringVar(&golemVersion, "golem-version", GOLEM_VERSION, "Version of Golem")
 	flag.BoolVar(&mainnet, "mainnet", false, "Whether to run on a mainnet")
+	flag.StringVar(&logLevel, "log-level", "info", "Minimal level of logged messages (debug, info, warn, error)")
+	flag.StringVar(&logFormat, "log-format", "text", "Format of the logs (text, json)")
+	flag.StringVar(&acceptedGolemMessages, "accepted-golem-messages", "", "Accepted golem-messages versions of peers, e.g. 2.24.x-2.26.x,2.28.0; any if empty")
+	flag.StringVar(&acceptedGolemVersions, "accepted-golem-versions", "", "Accepted Golem versions of peers; any if empty")
+	flag.BoolVar(&longLived, "long-lived", false, "Keep sessions open answering GetPeers and Ping")
+	flag.BoolVar(&allowReserved, "allow-reserved-addresses", false, "Store peers connecting from private, loopback and other non-public addresses")
+	flag.BoolVar(&sendPeerRecords, "send-peer-records", false, "Include the signed Hello of each peer in sent peer lists")
+	flag.DurationVar(&idleTimeout, "idle-timeout", bootstrap.DEFAULT_IDLE_TIMEOUT, "Idle timeout of long-lived sessions")
+	flag.DurationVar(&writeTimeout, "write-timeout", bootstrap.DEFAULT_WRITE_TIMEOUT, "Timeout of each response in long-lived sessions")
+	flag.DurationVar(&maxClockSkew, "max-clock-skew", 10*time.Minute, "Maximal accepted age of received messages, 0 disables the check")
+	flag.StringVar(&banFile, "ban-file", BAN_FILE, "Path of the persisted ban list")
+	flag.StringVar(&adminAddr, "admin-addr", "", "Loopback address of the admin HTTP endpoint, e.g. 127.0.0.1:40180, disabled if empty")
+	flag.BoolVar(&adminAllowRemote, "admin-allow-remote", false, "Allow -admin-addr to be a non-loopback address; the endpoint has no authentication")
+	flag.IntVar(&autoBanThreshold, "autoban-threshold", 0, "Signature failures after which an IP gets banned and the ban list saved, 0 disables")
+	flag.DurationVar(&autoBanWindow, "autoban-window", 10*time.Minute, "Window in which signature failures are counted")
+	flag.DurationVar(&autoBanDuration, "autoban-duration", 24*time.Hour, "Duration of automatic bans")
+	flag.StringVar(&extraNetworks, "extra-networks", "", "Additional networks served as protocol-id:port pairs, e.g. 31-testnet:40112")
+	flag.StringVar(&listenAddrs, "listen", "", "Comma separated IPv4/IPv6 addresses to listen on, all addresses of both families if empty")
+	flag.StringVar(&proxyTrusted, "proxy-trusted", "", "Comma separated CIDRs of load balancers sending the PROXY protocol header, disabled if empty")
 	flag.Parse()
 
+	level, err := logging.ParseLevel(logLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	log, err := logging.NewLogger(os.Stderr, level, logFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
 	if !mainnet {
 		protocolId += "-testnet"
 	}
+	if len(golemMessagesVersion) > message.HELLO_MAX_VERSION_LEN {
+		log.Error("invalid -golem-messages", "err", fmt.Sprintf("longer than %d bytes", message.HELLO_MAX_VERSION_LEN))
+		return
+	}
 
-	var err error
-	addrs, err := net.InterfaceAddrs()
+	acceptedGolemMessagesRanges, err := semver.ParseRanges(acceptedGolemMessages)
 	if err != nil {
-		fmt.Println("Error getting network interfaces:", err)
+		log.Error("invalid -accepted-golem-messages", "err", err)
 		return
 	}
-	prvAddresses := make([]interface{}, 0)
-	for _, a := range addrs {
-		if ipnet, ok := a.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
-			if ipnet.IP.To4() != nil {
-				prvAddresses = append(prvAddresses, ipnet.IP.String())
-			}
+	acceptedGolemVersionsRanges, err := semver.ParseRanges(acceptedGolemVersions)
+	if err != nil {
+		log.Error("invalid -accepted-golem-versions", "err", err)
+		return
+	}
+
+	proxyTrustedNets, err := proxyproto.ParseCIDRs(proxyTrusted)
+	if err != nil {
+		log.Error("invalid -proxy-trusted", "err", err)
+		return
+	}
+
+	bans, err := ban.LoadList(banFile)
+	if err != nil {
+		log.Error("error loading ban list", "err", err)
+		return
+	}
+	bans.SetAutoBanPolicy(ban.AutoBanPolicy{
+		Threshold: autoBanThreshold,
+		Window:    autoBanWindow,
+		Duration:  autoBanDuration,
+	})
+	reloadBans(bans, log)
+	if adminAddr != "" {
+		if err := checkAdminAddr(adminAddr, adminAllowRemote); err != nil {
+			log.Error("invalid -admin-addr", "err", err)
+			return
 		}
+		mux := http.NewServeMux()
+		mux.Handle("/bans", ban.NewHandler(bans))
+		go func() {
+			log.Info("serving admin endpoint", "addr", adminAddr)
+			if err := http.ListenAndServe(adminAddr, mux); err != nil {
+				log.Error("admin endpoint error", "err", err)
+			}
+		}()
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		log.Error("error getting network interfaces", "err", err)
+		return
+	}
+	prvAddresses := privateAddresses(addrs)
+	if len(prvAddresses) == 0 {
+		log.Error("no usable network interface address")
+		return
 	}
 
 	_, host, err := stun.NewClient().Discover()
 	if err != nil {
-		fmt.Println("Error discovering STUN details:", err)
+		log.Error("error discovering STUN details", "err", err)
 		return
 	}
 
 	privKey, err := crypto.GenerateDifficultKey(KEY_DIFF)
 	if err != nil {
-		log.Println("Error while generating private key", err)
+		log.Error("error while generating private key", "err", err)
 		return
 	}
 	pubKey := privKey.GetPublicKey()
@@ -76,24 +194,125 @@ func main() {
 		Name:                 name,
 		Id:                   pubKey.Hex(),
 		Port:                 port,
-		PrvAddr:              prvAddresses[0].(string),
+		PrvAddr:              prvAddresses[0],
 		PubAddr:              host.IP(),
 		PrvAddresses:         prvAddresses,
-		NatType:              make([]interface{}, 0),
-		PeerNum:              PEER_NUM,
+		PeerNum:              peerNum,
 		ProtocolId:           protocolId,
 		GolemMessagesVersion: golemMessagesVersion,
 		GolemVersion:         golemVersion,
+		IdleTimeout:          idleTimeout,
+		WriteTimeout:         writeTimeout,
+		MaxClockSkew:         maxClockSkew,
+		Logger:               log,
+		Bans:                 bans,
+		ListenAddrs:          splitList(listenAddrs),
+		ProxyTrusted:         proxyTrustedNets,
+
+		AllowReservedAddresses: allowReserved,
+		SendPeerRecords:        sendPeerRecords,
+
+		AcceptedGolemMessagesVersions: acceptedGolemMessagesRanges,
+		AcceptedGolemVersions:         acceptedGolemVersionsRanges,
 	}
 
-	fmt.Printf("Config: %+v\n", config)
+	if longLived {
+		config.SessionMode = bootstrap.SESSION_MODE_LONG_LIVED
+	}
+
+	log.Info("config",
+		"name", config.Name,
+		"id", config.Id,
+		"port", config.Port,
+		"prv_addr", config.PrvAddr,
+		"pub_addr", config.PubAddr,
+		"prv_addresses", config.PrvAddresses,
+		"listen", config.ListenAddrs,
+		"protocol_id", config.ProtocolId,
+		"golem_messages_version", config.GolemMessagesVersion,
+		"golem_version", config.GolemVersion,
+		"long_lived", longLived)
+
+	networks, err := parseNetworks(extraNetworks, config)
+	if err != nil {
+		log.Error("invalid -extra-networks", "err", err)
+		return
+	}
 
 	service := bootstrap.NewService(
 		config,
 		privKey,
 		peerkeeper.NewRandomizedPeerKeeper(config.PeerNum))
-	err = service.Listen()
+	for _, n := range networks {
+		if err := service.AddNetwork(n); err != nil {
+			log.Error("error adding network", "err", err)
+			return
+		}
+		log.Info("network", "protocol_id", n.ProtocolId, "port", n.Port)
+	}
+	err = serve(service, log)
 	if err != nil {
-		fmt.Println("Error during listen:", err)
+		log.Error("error during listen", "err", err)
 	}
 }
+
+// privateAddresses returns the non-loopback interface addresses, IPv4
+// ones first. Link-local IPv6 addresses are skipped since they are
+// useless to other hosts without the zone.
+func privateAddresses(addrs []net.Addr) []string {
+	ipv4 := make([]string, 0)
+	ipv6 := make([]string, 0)
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() || ipnet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if ipnet.IP.To4() != nil {
+			ipv4 = append(ipv4, ipnet.IP.String())
+		} else {
+			ipv6 = append(ipv6, ipnet.IP.String())
+		}
+	}
+	return append(ipv4, ipv6...)
+}
+
+func splitList(s string) []string {
+	res := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// checkAdminAddr makes sure the unauthenticated admin endpoint is only
+// reachable from the local host, unless explicitly allowed.
+func checkAdminAddr(addr string, allowRemote bool) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if allowRemote || host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("%v is not a loopback address, pass -admin-allow-remote to expose the endpoint", addr)
+}
+
+// reloadBans reloads the ban list from disk on every SIGHUP.
+func reloadBans(bans *ban.List, log logging.Logger) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			if err := bans.Reload(); err != nil {
+				log.Error("error reloading ban list", "err", err)
+			} else {
+				log.Info("reloaded ban list")
+			}
+		}
+	}()
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	bootstrap "github.com/golemfactory/bootstrap_go"
+	"github.com/golemfactory/bootstrap_go/peerkeeper"
+)
+
+// parseNetworks parses a comma separated list of protocol-id:port pairs,
+// the other network parameters are copied from the primary config.
+func parseNetworks(s string, config *bootstrap.Config) ([]bootstrap.Network, error) {
+	networks := make([]bootstrap.Network, 0)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		idx := strings.LastIndex(entry, ":")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid network %q, expected protocol-id:port", entry)
+		}
+		port, err := strconv.ParseUint(entry[idx+1:], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port of network %q: %v", entry, err)
+		}
+		networks = append(networks, bootstrap.Network{
+			ProtocolId:                    entry[:idx],
+			Port:                          port,
+			PeerNum:                       config.PeerNum,
+			GolemMessagesVersion:          config.GolemMessagesVersion,
+			GolemVersion:                  config.GolemVersion,
+			AcceptedGolemMessagesVersions: config.AcceptedGolemMessagesVersions,
+			AcceptedGolemVersions:         config.AcceptedGolemVersions,
+			PeerKeeper:                    peerkeeper.NewRandomizedPeerKeeper(config.PeerNum),
+		})
+	}
+	return networks, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	bootstrap "github.com/golemfactory/bootstrap_go"
+	"github.com/golemfactory/bootstrap_go/logging"
+	"github.com/golemfactory/bootstrap_go/systemd"
+)
+
+// serve runs the service on the listeners inherited through systemd
+// socket activation, or on its own ones otherwise, keeping the service
+// manager informed about the state.
+func serve(service *bootstrap.Service, log logging.Logger) error {
+	listeners, err := systemd.Listeners()
+	if err != nil {
+		return err
+	}
+	if len(listeners) > 0 {
+		log.Info("using socket activation", "listeners", len(listeners))
+	} else {
+		listeners, err = service.Bind()
+		if err != nil {
+			return err
+		}
+	}
+
+	notify(systemd.READY, log)
+	stop := make(chan struct{})
+	defer close(stop)
+	interval, err := systemd.WatchdogInterval()
+	if err != nil {
+		log.Warn("watchdog disabled", "err", err)
+	} else if interval > 0 {
+		go systemd.Watchdog(interval, stop)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-signals
+		log.Info("shutting down", "signal", sig.String())
+		notify(systemd.STOPPING, log)
+		service.Close()
+	}()
+
+	return service.Serve(listeners...)
+}
+
+func notify(state string, log logging.Logger) {
+	if _, err := systemd.Notify(state); err != nil {
+		log.Warn("error notifying systemd", "state", state, "err", err)
+	}
+}
@@ -0,0 +1,134 @@
+package message
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// FRAME_LEN_SIZE is the size of the big endian length prefix of frames.
+	FRAME_LEN_SIZE = 4
+	// MAX_FRAME_LEN bounds the length of received frames.
+	MAX_FRAME_LEN = 4 << 20
+	// READ_BUFFER_SIZE is the size of FrameReader's bufio buffer.
+	READ_BUFFER_SIZE = 4096
+	// maxPooledBufferCap keeps occasional big frames from being retained
+	// in the pool.
+	maxPooledBufferCap = 64 << 10
+)
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, READ_BUFFER_SIZE)
+		return &b
+	},
+}
+
+func getBuffer() *[]byte {
+	return bufferPool.Get().(*[]byte)
+}
+
+func putBuffer(b *[]byte) {
+	if cap(*b) > maxPooledBufferCap {
+		return
+	}
+	*b = (*b)[:0]
+	bufferPool.Put(b)
+}
+
+// FrameWriter writes length prefixed frames, each with a single write
+// call on the underlying writer.
+type FrameWriter struct {
+	w      io.Writer
+	lenBuf [FRAME_LEN_SIZE]byte
+}
+
+func NewFrameWriter(w io.Writer) *FrameWriter {
+	return &FrameWriter{w: w}
+}
+
+// WriteFrame writes the length prefix and the frame, with a single
+// writev call if the writer supports it.
+func (fw *FrameWriter) WriteFrame(frame []byte) error {
+	binary.BigEndian.PutUint32(fw.lenBuf[:], uint32(len(frame)))
+	bufs := net.Buffers{fw.lenBuf[:], frame}
+	_, err := bufs.WriteTo(fw.w)
+	return err
+}
+
+// WriteMessage serializes the message into a pooled buffer, prefixed
+// with its length, and writes it at once.
+func (fw *FrameWriter) WriteMessage(msg Message, now time.Time, encrypt EncryptFunc, sign SignFunc) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	b := append((*buf)[:0], 0, 0, 0, 0)
+	b, err := appendSerialized(b, msg, uint64(now.Unix()), encrypt, sign)
+	if err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(b, uint32(len(b)-FRAME_LEN_SIZE))
+	*buf = b
+	_, err = fw.w.Write(b)
+	return err
+}
+
+// FrameReader reads length prefixed frames. Timeout errors of the
+// underlying reader are returned as they are, so callers can tell them
+// apart.
+type FrameReader struct {
+	r      io.Reader
+	lenBuf [FRAME_LEN_SIZE]byte
+}
+
+// NewFrameReader creates a buffered reader, it may read ahead of the
+// current frame so r shouldn't be read directly afterwards.
+func NewFrameReader(r io.Reader) *FrameReader {
+	return &FrameReader{r: bufio.NewReaderSize(r, READ_BUFFER_SIZE)}
+}
+
+// ReadFrame appends the next frame to dst.
+func (fr *FrameReader) ReadFrame(dst []byte) ([]byte, error) {
+	if _, err := io.ReadFull(fr.r, fr.lenBuf[:]); err != nil {
+		return nil, readError(err)
+	}
+	frameLen := binary.BigEndian.Uint32(fr.lenBuf[:])
+	if frameLen > MAX_FRAME_LEN {
+		return nil, fmt.Errorf("frame length %d exceeds the limit of %d", frameLen, MAX_FRAME_LEN)
+	}
+	n := len(dst)
+	if cap(dst)-n < int(frameLen) {
+		grown := make([]byte, n, n+int(frameLen))
+		copy(grown, dst)
+		dst = grown
+	}
+	dst = dst[:n+int(frameLen)]
+	if _, err := io.ReadFull(fr.r, dst[n:]); err != nil {
+		return nil, readError(err)
+	}
+	return dst, nil
+}
+
+// ReadMessage reads and deserializes the next message, the frame is read
+// into a pooled buffer.
+func (fr *FrameReader) ReadMessage(decrypt DecryptFunc, verifySign VerifySignFunc, opts *Options) (Message, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	frame, err := fr.ReadFrame((*buf)[:0])
+	if err != nil {
+		return nil, err
+	}
+	*buf = frame
+	return Deserialize(frame, decrypt, verifySign, opts)
+}
+
+func readError(err error) error {
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return err
+	}
+	return fmt.Errorf("read message error: %v", err)
+}
@@ -0,0 +1,185 @@
+package message
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func noEncrypt(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+func fakeSign([]byte) ([]byte, error) {
+	return make([]byte, SIG_LEN), nil
+}
+
+func fakeVerifySign([]byte, []byte) bool {
+	return true
+}
+
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(b)
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	w := &countingWriter{}
+	fw := NewFrameWriter(w)
+	now := time.Unix(1000, 0)
+	require.NoError(t, fw.WriteMessage(&RandVal{RandVal: 0.5}, now, noEncrypt, fakeSign))
+	require.NoError(t, fw.WriteMessage(&Disconnect{Reason: DISCONNECT_BOOTSTRAP}, now, noEncrypt, fakeSign))
+	assert.Equal(t, 2, w.writes)
+	require.NoError(t, fw.WriteFrame([]byte("raw")))
+
+	fr := NewFrameReader(&w.Buffer)
+	msg, err := fr.ReadMessage(noEncrypt, fakeVerifySign, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, msg.(*RandVal).RandVal)
+	assert.Equal(t, uint64(1000), msg.GetTimestamp())
+	msg, err = fr.ReadMessage(noEncrypt, fakeVerifySign, nil)
+	require.NoError(t, err)
+	assert.Equal(t, DISCONNECT_BOOTSTRAP, msg.(*Disconnect).Reason)
+	frame, err := fr.ReadFrame([]byte("prefix-"))
+	require.NoError(t, err)
+	assert.Equal(t, "prefix-raw", string(frame))
+
+	_, err = fr.ReadFrame(nil)
+	assert.Error(t, err)
+}
+
+func TestFrameLimits(t *testing.T) {
+	lenBuf := make([]byte, FRAME_LEN_SIZE)
+	binary.BigEndian.PutUint32(lenBuf, MAX_FRAME_LEN+1)
+	_, err := NewFrameReader(bytes.NewReader(lenBuf)).ReadFrame(nil)
+	assert.Error(t, err)
+
+	b := &bytes.Buffer{}
+	require.NoError(t, NewFrameWriter(b).WriteFrame(make([]byte, HEADER_LEN)))
+	_, err = NewFrameReader(b).ReadMessage(noEncrypt, fakeVerifySign, nil)
+	assert.Error(t, err)
+}
+
+// The signature must survive the reuse of the pooled frame buffer.
+func TestFrameBufferReuse(t *testing.T) {
+	b := &bytes.Buffer{}
+	fw := NewFrameWriter(b)
+	for i := byte(1); i <= 2; i++ {
+		sig := bytes.Repeat([]byte{i}, SIG_LEN)
+		sign := func([]byte) ([]byte, error) { return sig, nil }
+		require.NoError(t, fw.WriteMessage(&Ping{}, time.Now(), noEncrypt, sign))
+	}
+	fr := NewFrameReader(b)
+	first, err := fr.ReadMessage(noEncrypt, fakeVerifySign, nil)
+	require.NoError(t, err)
+	_, err = fr.ReadMessage(noEncrypt, fakeVerifySign, nil)
+	require.NoError(t, err)
+	assert.Equal(t, bytes.Repeat([]byte{1}, SIG_LEN), first.GetSignature())
+}
+
+// legacySend and legacyReceive are the framing used before FrameWriter
+// and FrameReader, kept to compare the allocations.
+func legacySend(w io.Writer, msg Message) error {
+	serialized, err := Serialize(msg, noEncrypt, fakeSign)
+	if err != nil {
+		return err
+	}
+	lenBuf := make([]byte, 4)
+	binary.BigEndian.PutUint32(lenBuf, uint32(len(serialized)))
+	if _, err := w.Write(lenBuf); err != nil {
+		return err
+	}
+	_, err = w.Write(serialized)
+	return err
+}
+
+func legacyReceive(r io.Reader) (Message, error) {
+	lenBuf := make([]byte, 4)
+	if _, err := io.ReadFull(r, lenBuf); err != nil {
+		return nil, err
+	}
+	rawMsg := make([]byte, binary.BigEndian.Uint32(lenBuf))
+	if _, err := io.ReadFull(r, rawMsg); err != nil {
+		return nil, err
+	}
+	return Deserialize(rawMsg, noEncrypt, fakeVerifySign, nil)
+}
+
+func benchmarkPeers() Message {
+	peers := make([]interface{}, 20)
+	for i := range peers {
+		peers[i] = map[interface{}]interface{}{
+			"address":   "10.0.0.1",
+			"port":      uint64(40102),
+			"node_name": "benchmark node",
+		}
+	}
+	return &Peers{Peers: peers}
+}
+
+func BenchmarkLegacySend(b *testing.B) {
+	msg := benchmarkPeers()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := legacySend(ioutil.Discard, msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFrameWriter(b *testing.B) {
+	msg := benchmarkPeers()
+	fw := NewFrameWriter(ioutil.Discard)
+	now := time.Now()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := fw.WriteMessage(msg, now, noEncrypt, fakeSign); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func framesForBenchmark(b *testing.B) []byte {
+	buf := &bytes.Buffer{}
+	fw := NewFrameWriter(buf)
+	msg := &RandVal{RandVal: 0.5}
+	for i := 0; i < b.N; i++ {
+		if err := fw.WriteMessage(msg, time.Now(), noEncrypt, fakeSign); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func BenchmarkLegacyReceive(b *testing.B) {
+	r := bytes.NewReader(framesForBenchmark(b))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := legacyReceive(r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFrameReader(b *testing.B) {
+	fr := NewFrameReader(bytes.NewReader(framesForBenchmark(b)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := fr.ReadMessage(noEncrypt, fakeVerifySign, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
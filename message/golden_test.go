@@ -0,0 +1,291 @@
+package message
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golemfactory/bootstrap_go/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// updateGoVectors regenerates the go_*.json vectors pinning the frames
+// produced by this package. They only check this package against itself,
+// the compatibility is checked by the vectors captured from the Python
+// golem-messages with testdata/golden/capture.py.
+var updateGoVectors = flag.Bool("golden.update-go", false, "regenerate the go_*.json golden vectors")
+
+// Keys of capture.py.
+const (
+	GOLDEN_SENDER_KEY   = "1111111111111111111111111111111111111111111111111111111111111111"
+	GOLDEN_RECEIVER_KEY = "2222222222222222222222222222222222222222222222222222222222222222"
+)
+
+// goldenVector is a frame captured from the Python golem-messages,
+// see testdata/golden/capture.py, or produced by this package.
+type goldenVector struct {
+	GolemMessagesVersion string                 `json:"golem_messages_version"`
+	Type                 uint16                 `json:"type"`
+	Frame                string                 `json:"frame"`
+	SenderPublicKey      string                 `json:"sender_public_key"`
+	ReceiverPrivateKey   string                 `json:"receiver_private_key"`
+	Slots                map[string]interface{} `json:"slots"`
+	// Canonical is set by capture.py if golem-messages encoded the payload
+	// the way cbor2 does with canonical=True, so the re-encoded frame must
+	// be identical.
+	Canonical bool `json:"canonical,omitempty"`
+}
+
+// loadGoldenVectors loads the Python vectors or, if goVectors is set, the
+// ones produced by this package.
+func loadGoldenVectors(t *testing.T, goVectors bool) map[string]goldenVector {
+	paths, err := filepath.Glob(filepath.Join("testdata", "golden", "*.json"))
+	require.NoError(t, err)
+	vectors := make(map[string]goldenVector)
+	for _, path := range paths {
+		if strings.HasPrefix(filepath.Base(path), "go_") != goVectors {
+			continue
+		}
+		data, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		var v goldenVector
+		require.NoError(t, json.Unmarshal(data, &v), path)
+		vectors[filepath.Base(path)] = v
+	}
+	return vectors
+}
+
+// The disconnect reasons sent by the bootstrap, each has to be accepted
+// by the Python golem-messages.
+var sentDisconnectReasons = []DisconnectReason{
+	DISCONNECT_PROTOCOL_VERSION,
+	DISCONNECT_UNVERIFIED,
+	DISCONNECT_BOOTSTRAP,
+	DISCONNECT_TIMEOUT,
+}
+
+func TestPythonGoldenVectors(t *testing.T) {
+	vectors := loadGoldenVectors(t, false)
+	if len(vectors) == 0 {
+		t.Fatal("no Python golden vectors, capture them with testdata/golden/capture.py")
+	}
+	reasons := make(map[string]map[interface{}]bool)
+	for name, v := range vectors {
+		t.Run(name, func(t *testing.T) {
+			testGoldenVector(t, v, v.Canonical)
+		})
+		if reasons[v.GolemMessagesVersion] == nil {
+			reasons[v.GolemMessagesVersion] = make(map[interface{}]bool)
+		}
+		if v.Type == MSG_DISCONNECT_TYPE {
+			reasons[v.GolemMessagesVersion][v.Slots["reason"]] = true
+		}
+	}
+	for version, captured := range reasons {
+		for _, reason := range sentDisconnectReasons {
+			assert.True(t, captured[reason], "disconnect reason %v not captured from golem-messages %v", reason, version)
+		}
+	}
+}
+
+// TestGoVectors only checks this package against the frames it produced
+// before, see TestPythonGoldenVectors for the compatibility.
+func TestGoVectors(t *testing.T) {
+	if *updateGoVectors {
+		writeGoVectors(t)
+	}
+	vectors := loadGoldenVectors(t, true)
+	if len(vectors) == 0 {
+		t.Fatal("no Go golden vectors, regenerate them with -golden.update-go")
+	}
+	for name, v := range vectors {
+		t.Run(name, func(t *testing.T) {
+			testGoldenVector(t, v, true)
+		})
+	}
+}
+
+// testGoldenVector decodes the vector's frame verifying its signature,
+// checks the slot values and, if reencode is set, that the message is
+// encoded back to the same frame.
+func testGoldenVector(t *testing.T, v goldenVector, reencode bool) {
+	frame, err := hex.DecodeString(v.Frame)
+	require.NoError(t, err)
+	senderKeyBytes, err := hex.DecodeString(v.SenderPublicKey)
+	require.NoError(t, err)
+	senderKey, err := crypto.PublicKeyFromBytes(append([]byte{0x04}, senderKeyBytes...))
+	require.NoError(t, err)
+	receiverKeyBytes, err := hex.DecodeString(v.ReceiverPrivateKey)
+	require.NoError(t, err)
+	receiverKey, err := crypto.PrivateKeyFromBytes(receiverKeyBytes)
+	require.NoError(t, err)
+
+	var ciphertext, plaintext []byte
+	decrypt := func(data []byte) ([]byte, error) {
+		ciphertext = data
+		res, err := receiverKey.Decrypt(data)
+		plaintext = res
+		return res, err
+	}
+	var sig []byte
+	verifySign := func(shortHash []byte, s []byte) bool {
+		sig = s
+		return senderKey.VerifySign(ShortHashSha(shortHash), s)
+	}
+	msg, err := Deserialize(frame, decrypt, verifySign, nil)
+	require.NoError(t, err)
+	require.Equal(t, v.Type, msg.GetType())
+	require.NotNil(t, sig, "signature not verified")
+
+	slots := slotValues(msg)
+	for name, expected := range v.Slots {
+		actual, ok := slots[name]
+		if assert.True(t, ok, "slot %v missing in the Go message", name) {
+			assert.Equal(t, expected, normalizeSlot(actual), "slot %v", name)
+		}
+	}
+	if !reencode {
+		return
+	}
+
+	encrypt := func(data []byte) ([]byte, error) {
+		assert.Equal(t, plaintext, data)
+		return ciphertext, nil
+	}
+	sign := func(shortHash []byte) ([]byte, error) {
+		return sig, nil
+	}
+	reencoded, err := serialize(msg, msg.GetTimestamp(), encrypt, sign)
+	require.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(frame), hex.EncodeToString(reencoded))
+}
+
+func goldenMessages() map[string]Message {
+	senderKeyBytes, _ := hex.DecodeString(GOLDEN_SENDER_KEY)
+	senderKey, _ := crypto.PrivateKeyFromBytes(senderKeyBytes)
+	pubKey := senderKey.GetPublicKey()
+	node := map[interface{}]interface{}{
+		"node_name":     "golden",
+		"key":           pubKey.Hex(),
+		"prv_port":      uint64(40102),
+		"pub_port":      uint64(40102),
+		"p2p_prv_port":  uint64(40102),
+		"p2p_pub_port":  uint64(40102),
+		"prv_addr":      "10.0.0.1",
+		"pub_addr":      "1.2.3.4",
+		"prv_addresses": []interface{}{"10.0.0.1", "172.17.0.1"},
+		"nat_type":      []interface{}{},
+	}
+	return map[string]Message{
+		"hello": &Hello{
+			RandVal:              0.25,
+			ProtoId:              "31",
+			NodeName:             "golden",
+			NodeInfo:             node,
+			Port:                 40102,
+			ClientVer:            "0.19.0",
+			ClientKeyId:          pubKey.Hex(),
+			Metadata:             map[interface{}]interface{}{},
+			GolemMessagesVersion: "2.24.3",
+		},
+		"rand_val":   &RandVal{RandVal: 0.25},
+		"disconnect": &Disconnect{Reason: DISCONNECT_BOOTSTRAP},
+		"peers": &Peers{Peers: []interface{}{map[interface{}]interface{}{
+			"address":   "1.2.3.4",
+			"port":      uint64(40102),
+			"node":      node,
+			"node_name": "golden",
+		}}},
+	}
+}
+
+// writeGoVectors writes the vectors of goldenMessages serialized by this
+// package, in the format of capture.py.
+func writeGoVectors(t *testing.T) {
+	senderKeyBytes, err := hex.DecodeString(GOLDEN_SENDER_KEY)
+	require.NoError(t, err)
+	senderKey, err := crypto.PrivateKeyFromBytes(senderKeyBytes)
+	require.NoError(t, err)
+	receiverKeyBytes, err := hex.DecodeString(GOLDEN_RECEIVER_KEY)
+	require.NoError(t, err)
+	receiverKey, err := crypto.PrivateKeyFromBytes(receiverKeyBytes)
+	require.NoError(t, err)
+	senderPubKey := senderKey.GetPublicKey()
+	receiverPubKey := receiverKey.GetPublicKey()
+
+	encrypt := func(data []byte) ([]byte, error) {
+		return crypto.Encrypt(data, receiverPubKey)
+	}
+	sign := func(shortHash []byte) ([]byte, error) {
+		return senderKey.Sign(ShortHashSha(shortHash))
+	}
+	for name, msg := range goldenMessages() {
+		frame, err := Serialize(msg, encrypt, sign)
+		require.NoError(t, err)
+		slots := make(map[string]interface{})
+		for slot, value := range slotValues(msg) {
+			slots[slot] = normalizeSlot(value)
+		}
+		data, err := json.MarshalIndent(goldenVector{
+			GolemMessagesVersion: "go",
+			Type:                 msg.GetType(),
+			Frame:                hex.EncodeToString(frame),
+			SenderPublicKey:      senderPubKey.Hex(),
+			ReceiverPrivateKey:   GOLDEN_RECEIVER_KEY,
+			Slots:                slots,
+		}, "", "  ")
+		require.NoError(t, err)
+		path := filepath.Join("testdata", "golden", "go_"+name+".json")
+		require.NoError(t, ioutil.WriteFile(path, append(data, '\n'), 0644))
+	}
+}
+
+func slotValues(msg Message) map[string]interface{} {
+	res := make(map[string]interface{})
+	v := reflect.ValueOf(msg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if tag := v.Type().Field(i).Tag.Get("msg_slot"); tag != "" {
+			res[tag] = v.Field(i).Interface()
+		}
+	}
+	return res
+}
+
+// normalizeSlot converts a decoded slot value to the form encoding/json
+// produces for the vector's expected value.
+func normalizeSlot(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	if b, ok := v.([]byte); ok {
+		return hex.EncodeToString(b)
+	}
+	val := reflect.ValueOf(v)
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(val.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(val.Uint())
+	case reflect.Float32, reflect.Float64:
+		return val.Float()
+	case reflect.Slice:
+		res := make([]interface{}, val.Len())
+		for i := range res {
+			res[i] = normalizeSlot(val.Index(i).Interface())
+		}
+		return res
+	case reflect.Map:
+		res := make(map[string]interface{}, val.Len())
+		for _, k := range val.MapKeys() {
+			res[normalizeSlot(k.Interface()).(string)] = normalizeSlot(val.MapIndex(k).Interface())
+		}
+		return res
+	}
+	return v
+}
@@ -13,13 +13,17 @@ type Header struct {
 }
 
 func (self *Header) serialize() []byte {
-	res := make([]byte, HEADER_LEN)
-	binary.BigEndian.PutUint16(res, self.Type)
+	return self.appendTo(make([]byte, 0, HEADER_LEN))
+}
+
+func (self *Header) appendTo(dst []byte) []byte {
+	var res [HEADER_LEN]byte
+	binary.BigEndian.PutUint16(res[:], self.Type)
 	binary.BigEndian.PutUint64(res[2:], self.Timestamp)
 	if self.Encrypted {
 		res[10] = 1
 	}
-	return res
+	return append(dst, res[:]...)
 }
 
 func deserializeHeader(header []byte) Header {
@@ -2,98 +2,245 @@ package message
 
 import (
 	"crypto/sha1"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/golemfactory/bootstrap_go/cbor"
+	"github.com/golemfactory/bootstrap_go/clock"
+	"github.com/golemfactory/bootstrap_go/logging"
+	"golang.org/x/crypto/sha3"
 )
 
 const (
 	SIG_LEN = 65
 )
 
+var ErrIncorrectSignature = errors.New("incorrect signature")
+
+var defaultDecodeOptions = cbor.DefaultDecodeOptions()
+
+// Message is a golem message. Custom messages should embed BaseMessage,
+// declare GetType and ShouldEncrypt and tag the payload fields with
+// `msg_slot:"<python slot name>"`. Messages followed by extra trailing
+// data override SerializationExtraData, ExtraDataLen and ParseExtraData.
+// Messages without generated slot codecs (see SlotEncoder) are serialized
+// with reflection. See Register.
 type Message interface {
 	GetType() uint16
 
-	shouldEncrypt() bool
+	ShouldEncrypt() bool
 
-	getSignature() []byte
-	setSignature(sig []byte)
+	GetSignature() []byte
+	SetSignature(sig []byte)
 
-	getTimestamp() uint64
-	setTimestamp(ts uint64)
+	GetTimestamp() uint64
+	SetTimestamp(ts uint64)
 
-	serializationExtraData() []byte
+	// SerializationExtraData returns the trailing data of sent messages.
+	SerializationExtraData() ([]byte, error)
+	// ExtraDataLen is the length of the trailing data of received messages.
+	ExtraDataLen() int
+	ParseExtraData(data []byte) error
 }
 
-type baseMessage struct {
+// BaseMessage implements the parts of Message common to all messages.
+type BaseMessage struct {
 	Timestamp uint64
 	Sig       []byte
+	shortHash []byte
+	// unknownSlots are collected with UNKNOWN_SLOTS_COLLECT
+	unknownSlots map[string]interface{}
+}
+
+// ShortHash is the hash the signature of a received message is verified
+// against, computed from the payload bytes as received.
+func (self *BaseMessage) ShortHash() []byte {
+	return self.shortHash
+}
+
+func (self *BaseMessage) setShortHash(hash []byte) {
+	self.shortHash = hash
+}
+
+type shortHashSetter interface {
+	setShortHash(hash []byte)
+}
+
+// rawPayloadSetter is implemented by messages keeping their payload.
+type rawPayloadSetter interface {
+	setRawPayload(payload []byte)
 }
 
-func (self *baseMessage) getSignature() []byte {
+// UnknownSlots are the received slots the message doesn't declare, only
+// collected when decoding with UNKNOWN_SLOTS_COLLECT.
+func (self *BaseMessage) UnknownSlots() map[string]interface{} {
+	return self.unknownSlots
+}
+
+func (self *BaseMessage) setUnknownSlots(slots map[string]interface{}) {
+	self.unknownSlots = slots
+}
+
+type unknownSlotsSetter interface {
+	setUnknownSlots(slots map[string]interface{})
+}
+
+func (self *BaseMessage) GetSignature() []byte {
 	return self.Sig
 }
 
-func (self *baseMessage) setSignature(sig []byte) {
+func (self *BaseMessage) SetSignature(sig []byte) {
 	self.Sig = sig
 }
 
-func (self *baseMessage) getTimestamp() uint64 {
+func (self *BaseMessage) GetTimestamp() uint64 {
 	return self.Timestamp
 }
 
-func (self *baseMessage) setTimestamp(ts uint64) {
+func (self *BaseMessage) SetTimestamp(ts uint64) {
 	self.Timestamp = ts
 }
 
-func (self *baseMessage) serializationExtraData() []byte {
-	return []byte{}
+func (self *BaseMessage) SerializationExtraData() ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (self *BaseMessage) ExtraDataLen() int {
+	return 0
+}
+
+func (self *BaseMessage) ParseExtraData(data []byte) error {
+	return nil
 }
 
 type EncryptFunc = func([]byte) ([]byte, error)
 type SignFunc = func([]byte) ([]byte, error)
 
 func Serialize(msg Message, encrypt EncryptFunc, sign SignFunc) ([]byte, error) {
+	return SerializeAt(msg, time.Now(), encrypt, sign)
+}
+
+// SerializeAt serializes the message with the given timestamp, e.g. taken
+// from an injected clock.
+func SerializeAt(msg Message, now time.Time, encrypt EncryptFunc, sign SignFunc) ([]byte, error) {
+	return serialize(msg, uint64(now.Unix()), encrypt, sign)
+}
+
+func serialize(msg Message, timestamp uint64, encrypt EncryptFunc, sign SignFunc) ([]byte, error) {
+	return appendSerialized(nil, msg, timestamp, encrypt, sign)
+}
+
+// appendSerialized appends the serialized message to dst.
+func appendSerialized(dst []byte, msg Message, timestamp uint64, encrypt EncryptFunc, sign SignFunc) ([]byte, error) {
 	header := Header{
 		Type:      msg.GetType(),
-		Timestamp: uint64(time.Now().Unix()),
-		Encrypted: msg.shouldEncrypt(),
+		Timestamp: timestamp,
+		Encrypted: msg.ShouldEncrypt(),
 	}
-	headerBytes := header.serialize()
 	payloadBytes, err := getSerializedPayload(msg)
 	if err != nil {
 		return nil, err
 	}
-	if msg.shouldEncrypt() {
+	extraData, err := msg.SerializationExtraData()
+	if err != nil {
+		return nil, err
+	}
+	msg.SetTimestamp(header.Timestamp)
+	shortHash, err := getShortHash(header.Type, header.Timestamp, payloadBytes)
+	if err != nil {
+		return nil, err
+	}
+	if msg.ShouldEncrypt() {
 		payloadBytes, err = encrypt(payloadBytes)
 		if err != nil {
 			return nil, err
 		}
 	}
-	msg.setTimestamp(header.Timestamp)
-	shortHash, err := getShortHash(msg)
-	if err != nil {
-		return nil, err
-	}
 	sigBytes, err := sign(shortHash)
 	if err != nil {
 		return nil, err
 	}
 
-	res := make([]byte, 0, len(headerBytes)+len(sigBytes)+len(payloadBytes))
-	res = append(res, headerBytes...)
-	res = append(res, sigBytes...)
-	res = append(res, payloadBytes...)
-	res = append(res, msg.serializationExtraData()...)
-	return res, nil
+	if need := HEADER_LEN + len(sigBytes) + len(payloadBytes) + len(extraData); cap(dst)-len(dst) < need {
+		grown := make([]byte, len(dst), len(dst)+need)
+		copy(grown, dst)
+		dst = grown
+	}
+	dst = header.appendTo(dst)
+	dst = append(dst, sigBytes...)
+	dst = append(dst, payloadBytes...)
+	dst = append(dst, extraData...)
+	return dst, nil
 }
 
 type DecryptFunc = func([]byte) ([]byte, error)
 type VerifySignFunc = func([]byte, []byte) bool
 
-func Deserialize(b []byte, decrypt DecryptFunc, verifySign VerifySignFunc) (Message, error) {
+// Options holds optional dependencies of the decoding functions.
+// A nil *Options is valid and means the defaults.
+type Options struct {
+	Logger logging.Logger
+	// MaxClockSkew is the maximal allowed difference between the timestamp
+	// of a received message and Clock. Zero disables the check.
+	MaxClockSkew time.Duration
+	// Clock defaults to the system clock.
+	Clock clock.Clock
+	// UnknownSlots defaults to UNKNOWN_SLOTS_IGNORE.
+	UnknownSlots UnknownSlotsPolicy
+	// Decode limits the payload decoding, defaults to
+	// cbor.DefaultDecodeOptions.
+	Decode *cbor.DecodeOptions
+}
+
+func (self *Options) logger() logging.Logger {
+	if self == nil || self.Logger == nil {
+		return logging.NewNopLogger()
+	}
+	return self.Logger
+}
+
+func (self *Options) clock() clock.Clock {
+	if self == nil || self.Clock == nil {
+		return clock.System()
+	}
+	return self.Clock
+}
+
+func (self *Options) decodeOptions() *cbor.DecodeOptions {
+	if self == nil || self.Decode == nil {
+		return defaultDecodeOptions
+	}
+	return self.Decode
+}
+
+func (self *Options) unknownSlots() UnknownSlotsPolicy {
+	if self == nil {
+		return UNKNOWN_SLOTS_IGNORE
+	}
+	return self.UnknownSlots
+}
+
+func (self *Options) checkTimestamp(ts uint64) error {
+	if self == nil || self.MaxClockSkew == 0 {
+		return nil
+	}
+	msgTime := time.Unix(int64(ts), 0)
+	skew := self.clock().Now().Sub(msgTime)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > self.MaxClockSkew {
+		return fmt.Errorf("message timestamp %v differs from local time by %v", msgTime.UTC(), skew)
+	}
+	return nil
+}
+
+func Deserialize(b []byte, decrypt DecryptFunc, verifySign VerifySignFunc, opts *Options) (Message, error) {
 	payloadIdx := HEADER_LEN + SIG_LEN
+	if len(b) < payloadIdx {
+		return nil, fmt.Errorf("message too short: %d bytes", len(b))
+	}
 	headerB := b[:HEADER_LEN]
 	sigB := b[HEADER_LEN:payloadIdx]
 	payloadB := b[payloadIdx:]
@@ -103,9 +250,25 @@ func Deserialize(b []byte, decrypt DecryptFunc, verifySign VerifySignFunc) (Mess
 	if err != nil {
 		return nil, err
 	}
+	if err := opts.checkTimestamp(header.Timestamp); err != nil {
+		return nil, err
+	}
 
-	msg.setSignature(sigB)
-	msg.setTimestamp(header.Timestamp)
+	// b may be a reused buffer
+	msg.SetSignature(append([]byte(nil), sigB...))
+	msg.SetTimestamp(header.Timestamp)
+
+	if extraLen := msg.ExtraDataLen(); extraLen > 0 {
+		if len(payloadB) < extraLen {
+			return nil, fmt.Errorf("message too short for %d bytes of extra data", extraLen)
+		}
+		// b may be a reused buffer
+		extraB := append([]byte(nil), payloadB[len(payloadB)-extraLen:]...)
+		payloadB = payloadB[:len(payloadB)-extraLen]
+		if err := msg.ParseExtraData(extraB); err != nil {
+			return nil, err
+		}
+	}
 
 	if header.Encrypted {
 		payloadB, err = decrypt(payloadB)
@@ -114,32 +277,50 @@ func Deserialize(b []byte, decrypt DecryptFunc, verifySign VerifySignFunc) (Mess
 		}
 	}
 
-	err = deserializePayload(payloadB, msg)
+	err = deserializePayload(payloadB, msg, opts)
 	if err != nil {
 		return nil, err
 	}
-	shortHash, err := getShortHash(msg)
+	shortHash, err := getShortHash(header.Type, header.Timestamp, payloadB)
 	if err != nil {
 		return nil, err
 	}
+	if setter, ok := msg.(shortHashSetter); ok {
+		setter.setShortHash(shortHash)
+	}
+	if setter, ok := msg.(rawPayloadSetter); ok {
+		// b may be a reused buffer
+		setter.setRawPayload(append([]byte(nil), payloadB...))
+	}
 	if !verifySign(shortHash, sigB) {
-		return nil, fmt.Errorf("incorrect signature")
+		return nil, ErrIncorrectSignature
 	}
 	return msg, nil
 }
 
-func getShortHash(msg Message) ([]byte, error) {
-	headerBytes, err := cbor.Serialize([]interface{}{msg.GetType(), msg.getTimestamp()})
-	if err != nil {
-		return nil, err
-	}
-	payloadBytes, err := getSerializedPayload(msg)
+// ComputeShortHash returns the hash a message of the given type, timestamp
+// and serialized payload is signed over.
+func ComputeShortHash(typ uint16, timestamp uint64, payload []byte) ([]byte, error) {
+	return getShortHash(typ, timestamp, payload)
+}
+
+// ShortHashSha returns the digest of a short hash which gets signed, both
+// in frames and in peer records.
+func ShortHashSha(shortHash []byte) []byte {
+	sha := sha3.New256()
+	sha.Write(shortHash)
+	return sha.Sum(nil)
+}
+
+// getShortHash hashes the serialized payload together with the type and
+// timestamp, the same way golem-messages does.
+func getShortHash(typ uint16, timestamp uint64, payload []byte) ([]byte, error) {
+	headerBytes, err := cbor.Serialize([]interface{}{typ, timestamp})
 	if err != nil {
 		return nil, err
 	}
-	data := make([]byte, 0, len(headerBytes)+len(payloadBytes))
-	data = append(data, headerBytes...)
-	data = append(data, payloadBytes...)
-	hash := sha1.Sum(data)
-	return hash[:], nil
+	h := sha1.New()
+	h.Write(headerBytes)
+	h.Write(payload)
+	return h.Sum(nil), nil
 }
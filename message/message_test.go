@@ -1,8 +1,14 @@
 package message
 
 import (
+	"encoding/hex"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/golemfactory/bootstrap_go/cbor"
+	"github.com/golemfactory/bootstrap_go/clock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -38,17 +44,17 @@ func testImpl(t *testing.T, msg Message) Message {
 
 	serialized, err := Serialize(msg, encryptFunc, signFunc)
 	require.NoError(t, err)
-	assert.Equal(t, msg.shouldEncrypt(), encryptCalled)
+	assert.Equal(t, msg.ShouldEncrypt(), encryptCalled)
 	assert.True(t, signCalled)
 
-	deserialized, err := Deserialize(serialized, decryptFunc, verifySignFunc)
+	deserialized, err := Deserialize(serialized, decryptFunc, verifySignFunc, nil)
 	require.NoError(t, err)
-	assert.Equal(t, msg.shouldEncrypt(), decryptCalled)
+	assert.Equal(t, msg.ShouldEncrypt(), decryptCalled)
 	assert.True(t, verifySignCalled)
 
 	assert.Equal(t, msg.GetType(), deserialized.GetType())
-	assert.Equal(t, sig, deserialized.getSignature())
-	assert.NotZero(t, deserialized.getTimestamp())
+	assert.Equal(t, sig, deserialized.GetSignature())
+	assert.NotZero(t, deserialized.GetTimestamp())
 	return deserialized
 }
 
@@ -57,7 +63,7 @@ func TestSerializationEncrypted(t *testing.T) {
 	msg := &RandVal{
 		RandVal: RAND_VAL,
 	}
-	require.True(t, msg.shouldEncrypt())
+	require.True(t, msg.ShouldEncrypt())
 	deserialized := testImpl(t, msg)
 
 	castedMsg, ok := deserialized.(*RandVal)
@@ -70,10 +76,107 @@ func TestSerializationNotEncrypted(t *testing.T) {
 	msg := &Disconnect{
 		Reason: REASON,
 	}
-	require.False(t, msg.shouldEncrypt())
+	require.False(t, msg.ShouldEncrypt())
 	deserialized := testImpl(t, msg)
 
 	castedMsg, ok := deserialized.(*Disconnect)
 	require.True(t, ok)
 	assert.Equal(t, REASON, castedMsg.Reason)
 }
+
+func TestSerializationAllTypes(t *testing.T) {
+	for typ, factory := range registeredTypes {
+		deserialized := testImpl(t, factory())
+		assert.Equal(t, typ, deserialized.GetType())
+	}
+}
+
+func TestSerializationFindNode(t *testing.T) {
+	const KEY_ID = "deadbeef"
+	deserialized := testImpl(t, &FindNode{NodeKeyId: KEY_ID})
+
+	castedMsg, ok := deserialized.(*FindNode)
+	require.True(t, ok)
+	assert.Equal(t, KEY_ID, castedMsg.NodeKeyId)
+}
+
+func TestClockSkew(t *testing.T) {
+	sign := func([]byte) ([]byte, error) { return make([]byte, SIG_LEN), nil }
+	verifySign := func([]byte, []byte) bool { return true }
+	serialized, err := serialize(&Disconnect{}, 1000, nil, sign)
+	require.NoError(t, err)
+
+	c := clock.NewFake(time.Unix(1000, 0))
+	opts := &Options{MaxClockSkew: time.Minute, Clock: c}
+	_, err = Deserialize(serialized, nil, verifySign, opts)
+	assert.NoError(t, err)
+
+	c.Advance(time.Minute + time.Second)
+	_, err = Deserialize(serialized, nil, verifySign, opts)
+	assert.Error(t, err)
+
+	c.Set(time.Unix(1000, 0).Add(-time.Minute - time.Second))
+	_, err = Deserialize(serialized, nil, verifySign, opts)
+	assert.Error(t, err)
+}
+
+func TestReplayCache(t *testing.T) {
+	c := clock.NewFake(time.Unix(1000, 0))
+	cache := NewReplayCache(time.Minute, c)
+	assert.False(t, cache.Seen([]byte{1}))
+	assert.True(t, cache.Seen([]byte{1}))
+	c.Advance(30 * time.Second)
+	assert.False(t, cache.Seen([]byte{2}))
+	c.Advance(30 * time.Second)
+	assert.False(t, cache.Seen([]byte{1}))
+	assert.True(t, cache.Seen([]byte{2}))
+
+	// the oldest keys are forgotten once the cache is full
+	for i := 0; i < REPLAY_CACHE_MAX_KEYS; i++ {
+		assert.False(t, cache.Seen([]byte(fmt.Sprintf("key-%d", i))))
+	}
+	assert.True(t, cache.Seen([]byte(fmt.Sprintf("key-%d", REPLAY_CACHE_MAX_KEYS-1))))
+	assert.False(t, cache.Seen([]byte{1}))
+	assert.Equal(t, REPLAY_CACHE_MAX_KEYS, len(cache.keys))
+	assert.Equal(t, REPLAY_CACHE_MAX_KEYS, len(cache.entries))
+}
+
+func TestHelloTrailer(t *testing.T) {
+	const VERSION = "2.24.3"
+	deserialized := testImpl(t, &Hello{GolemMessagesVersion: VERSION})
+	castedMsg, ok := deserialized.(*Hello)
+	require.True(t, ok)
+	assert.Equal(t, VERSION, castedMsg.GolemMessagesVersion)
+	assert.Equal(t, VERSION, castedMsg.TrailerVersion)
+
+	trailer := make([]byte, HELLO_EXTRA_DATA_LEN)
+	trailer[0] = HELLO_EXTRA_DATA_LEN
+	assert.Error(t, castedMsg.ParseExtraData(trailer))
+	trailer[0] = 1
+	trailer[5] = 1
+	assert.Error(t, castedMsg.ParseExtraData(trailer))
+
+	testImpl(t, &Hello{GolemMessagesVersion: strings.Repeat("1", HELLO_MAX_VERSION_LEN)})
+	sign := func([]byte) ([]byte, error) {
+		return make([]byte, SIG_LEN), nil
+	}
+	_, err := Serialize(&Hello{GolemMessagesVersion: strings.Repeat("1", HELLO_MAX_VERSION_LEN+1)}, nil, sign)
+	assert.Error(t, err)
+}
+
+func TestCanonicalPayload(t *testing.T) {
+	payload, err := getSerializedPayload(&RandVal{RandVal: 0.25})
+	require.NoError(t, err)
+	// the shortest float preserving the value
+	assert.Equal(t, "818268"+"72616e645f76616c"+"f93400", hex.EncodeToString(payload))
+
+	payload, err = getSerializedPayload(&Hello{NodeInfo: map[interface{}]interface{}{
+		"prv_port": uint64(40102), "key": "k", "node_name": "n",
+	}})
+	require.NoError(t, err)
+	expected, err := cbor.SerializeCanonical(reflectEncodeSlots(&Hello{NodeInfo: map[interface{}]interface{}{
+		"node_name": "n", "key": "k", "prv_port": uint64(40102),
+	}}))
+	require.NoError(t, err)
+	assert.Equal(t, expected, payload)
+}
@@ -6,11 +6,10 @@ const (
 	MSG_HELLO_TYPE      = 0
 	MSG_RAND_VAL_TYPE   = 1
 	MSG_DISCONNECT_TYPE = 2
-	MSG_PEERS_TYPE      = 1004
 )
 
 type Hello struct {
-	baseMessage
+	BaseMessage
 	RandVal              float64                     `msg_slot:"rand_val"`
 	ProtoId              string                      `msg_slot:"proto_id"`
 	NodeName             string                      `msg_slot:"node_name"`
@@ -23,27 +22,70 @@ type Hello struct {
 	Difficulty           uint64                      `msg_slot:"difficulty"`
 	Metadata             interface{}                 `msg_slot:"metadata"`
 	GolemMessagesVersion string                      `msg_slot:"_version"`
+	// TrailerVersion is the golem-messages version parsed from the trailing
+	// data of a received Hello.
+	TrailerVersion string
+	rawPayload     []byte
+}
+
+// RawPayload is the payload of a received Hello as signed by the sender,
+// so the signature can be verified again by others.
+func (self *Hello) RawPayload() []byte {
+	return self.rawPayload
+}
+
+func (self *Hello) setRawPayload(payload []byte) {
+	self.rawPayload = payload
 }
 
 func (self *Hello) GetType() uint16 {
 	return MSG_HELLO_TYPE
 }
 
-func (self *Hello) shouldEncrypt() bool {
+func (self *Hello) ShouldEncrypt() bool {
 	return false
 }
 
-func (self *Hello) serializationExtraData() []byte {
-	res := make([]byte, 0, 32)
+func (self *Hello) SerializationExtraData() ([]byte, error) {
 	vlen := len(self.GolemMessagesVersion)
+	if vlen > HELLO_MAX_VERSION_LEN {
+		return nil, fmt.Errorf("golem-messages version %q longer than %d bytes", self.GolemMessagesVersion, HELLO_MAX_VERSION_LEN)
+	}
+	res := make([]byte, 0, HELLO_EXTRA_DATA_LEN)
 	res = append(res, byte(vlen))
 	res = append(res, []byte(self.GolemMessagesVersion)...)
-	res = append(res, make([]byte, 31-vlen)...)
-	return res
+	res = append(res, make([]byte, HELLO_MAX_VERSION_LEN-vlen)...)
+	return res, nil
+}
+
+const HELLO_EXTRA_DATA_LEN = 32
+
+// HELLO_MAX_VERSION_LEN is the longest golem-messages version fitting in
+// the trailer after its length byte.
+const HELLO_MAX_VERSION_LEN = HELLO_EXTRA_DATA_LEN - 1
+
+func (self *Hello) ExtraDataLen() int {
+	return HELLO_EXTRA_DATA_LEN
+}
+
+// ParseExtraData parses the version trailer: a length byte followed by
+// the version string padded with zeros.
+func (self *Hello) ParseExtraData(data []byte) error {
+	vlen := int(data[0])
+	if vlen > len(data)-1 {
+		return fmt.Errorf("malformed Hello trailer: version length %d", vlen)
+	}
+	for _, b := range data[1+vlen:] {
+		if b != 0 {
+			return fmt.Errorf("malformed Hello trailer: non-zero padding")
+		}
+	}
+	self.TrailerVersion = string(data[1 : 1+vlen])
+	return nil
 }
 
 type RandVal struct {
-	baseMessage
+	BaseMessage
 	RandVal float64 `msg_slot:"rand_val"`
 }
 
@@ -51,7 +93,7 @@ func (self *RandVal) GetType() uint16 {
 	return MSG_RAND_VAL_TYPE
 }
 
-func (self *RandVal) shouldEncrypt() bool {
+func (self *RandVal) ShouldEncrypt() bool {
 	return true
 }
 
@@ -61,10 +103,11 @@ const (
 	DISCONNECT_PROTOCOL_VERSION DisconnectReason = "protocol_version"
 	DISCONNECT_UNVERIFIED       DisconnectReason = "unverified"
 	DISCONNECT_BOOTSTRAP        DisconnectReason = "bootstrap"
+	DISCONNECT_TIMEOUT          DisconnectReason = "timeout"
 )
 
 type Disconnect struct {
-	baseMessage
+	BaseMessage
 	Reason DisconnectReason `msg_slot:"reason"`
 }
 
@@ -72,44 +115,33 @@ func (self *Disconnect) GetType() uint16 {
 	return MSG_DISCONNECT_TYPE
 }
 
-func (self *Disconnect) shouldEncrypt() bool {
+func (self *Disconnect) ShouldEncrypt() bool {
 	return false
 }
 
-type Peers struct {
-	baseMessage
-	Peers []interface{} `msg_slot:"peers"`
-}
-
-func (self *Peers) GetType() uint16 {
-	return MSG_PEERS_TYPE
-}
-
-func (self *Peers) shouldEncrypt() bool {
-	return true
-}
-
-var registeredTypes = make(map[uint16]func() Message)
-
-func newByType(typ uint16) (Message, error) {
-	factory, ok := registeredTypes[typ]
-	if !ok {
-		return nil, fmt.Errorf("unsupported msg type %d", typ)
-	}
-	return factory(), nil
-}
-
 func init() {
 	factories := []func() Message{
 		func() Message { return &Hello{} },
 		func() Message { return &RandVal{} },
 		func() Message { return &Disconnect{} },
+		func() Message { return &Ping{} },
+		func() Message { return &Pong{} },
+		func() Message { return &GetPeers{} },
 		func() Message { return &Peers{} },
+		func() Message { return &GetTasks{} },
+		func() Message { return &Tasks{} },
+		func() Message { return &RemoveTask{} },
+		func() Message { return &GetResourcePeers{} },
+		func() Message { return &ResourcePeers{} },
+		func() Message { return &Degree{} },
+		func() Message { return &Gossip{} },
+		func() Message { return &StopGossip{} },
+		func() Message { return &LocRank{} },
+		func() Message { return &FindNode{} },
+		func() Message { return &WantToStartTaskSession{} },
+		func() Message { return &SetTaskSession{} },
 	}
 	for _, factory := range factories {
-		registeredTypes[factory().GetType()] = factory
-	}
-	if len(factories) != len(registeredTypes) {
-		panic("Duplicated message types")
+		MustRegister(factory)
 	}
 }
@@ -1,47 +1,23 @@
 package message
 
 import (
-	"encoding/binary"
-	"fmt"
-	"io"
 	"net"
+	"time"
 )
 
 func Send(conn net.Conn, msg Message, encrypt EncryptFunc, sign SignFunc) error {
-	serialized, err := Serialize(msg, encrypt, sign)
-	if err != nil {
-		return err
-	}
-	lenBuf := make([]byte, 4)
-	binary.BigEndian.PutUint32(lenBuf, uint32(len(serialized)))
-	_, err = conn.Write(lenBuf)
-	if err != nil {
-		return err
-	}
-	_, err = conn.Write(serialized)
-	if err != nil {
-		return err
-	}
-	return nil
+	return SendAt(conn, msg, time.Now(), encrypt, sign)
 }
 
-func Receive(conn net.Conn, decrypt DecryptFunc, verifySign VerifySignFunc) (Message, error) {
-	lenBuf := make([]byte, 4)
-	lenRead, err := io.ReadFull(conn, lenBuf)
-	if err != nil {
-		return nil, fmt.Errorf("read message error: %v", err)
-	}
-	if lenRead != len(lenBuf) {
-		return nil, fmt.Errorf("read %d bytes instead of %d", lenRead, len(lenBuf))
-	}
-	msgLen := binary.BigEndian.Uint32(lenBuf)
-	rawMsg := make([]byte, msgLen)
-	lenRead, err = io.ReadFull(conn, rawMsg)
-	if err != nil {
-		return nil, fmt.Errorf("read message error: %v", err)
-	}
-	if uint32(lenRead) != msgLen {
-		return nil, fmt.Errorf("read %d bytes instead of %d", lenRead, msgLen)
-	}
-	return Deserialize(rawMsg, decrypt, verifySign)
+// SendAt sends the message with the given timestamp.
+func SendAt(conn net.Conn, msg Message, now time.Time, encrypt EncryptFunc, sign SignFunc) error {
+	return NewFrameWriter(conn).WriteMessage(msg, now, encrypt, sign)
+}
+
+// Receive reads and deserializes a single message without reading ahead
+// of it. Timeout errors of conn are returned as they are, so callers can
+// tell them apart.
+func Receive(conn net.Conn, decrypt DecryptFunc, verifySign VerifySignFunc, opts *Options) (Message, error) {
+	fr := &FrameReader{r: conn}
+	return fr.ReadMessage(decrypt, verifySign, opts)
 }
@@ -0,0 +1,231 @@
+package message
+
+// P2P message family, see golem_messages/message/p2p.py.
+// All of them are encrypted.
+
+const (
+	MSG_PING_TYPE                       = 1001
+	MSG_PONG_TYPE                       = 1002
+	MSG_GET_PEERS_TYPE                  = 1003
+	MSG_PEERS_TYPE                      = 1004
+	MSG_GET_TASKS_TYPE                  = 1005
+	MSG_TASKS_TYPE                      = 1006
+	MSG_REMOVE_TASK_TYPE                = 1007
+	MSG_GET_RESOURCE_PEERS_TYPE         = 1008
+	MSG_RESOURCE_PEERS_TYPE             = 1009
+	MSG_DEGREE_TYPE                     = 1010
+	MSG_GOSSIP_TYPE                     = 1011
+	MSG_STOP_GOSSIP_TYPE                = 1012
+	MSG_LOC_RANK_TYPE                   = 1013
+	MSG_FIND_NODE_TYPE                  = 1014
+	MSG_WANT_TO_START_TASK_SESSION_TYPE = 1015
+	MSG_SET_TASK_SESSION_TYPE           = 1016
+)
+
+type Ping struct {
+	BaseMessage
+}
+
+func (self *Ping) GetType() uint16 {
+	return MSG_PING_TYPE
+}
+
+func (self *Ping) ShouldEncrypt() bool {
+	return true
+}
+
+type Pong struct {
+	BaseMessage
+}
+
+func (self *Pong) GetType() uint16 {
+	return MSG_PONG_TYPE
+}
+
+func (self *Pong) ShouldEncrypt() bool {
+	return true
+}
+
+type GetPeers struct {
+	BaseMessage
+}
+
+func (self *GetPeers) GetType() uint16 {
+	return MSG_GET_PEERS_TYPE
+}
+
+func (self *GetPeers) ShouldEncrypt() bool {
+	return true
+}
+
+type Peers struct {
+	BaseMessage
+	Peers []interface{} `msg_slot:"peers"`
+}
+
+func (self *Peers) GetType() uint16 {
+	return MSG_PEERS_TYPE
+}
+
+func (self *Peers) ShouldEncrypt() bool {
+	return true
+}
+
+type GetTasks struct {
+	BaseMessage
+}
+
+func (self *GetTasks) GetType() uint16 {
+	return MSG_GET_TASKS_TYPE
+}
+
+func (self *GetTasks) ShouldEncrypt() bool {
+	return true
+}
+
+type Tasks struct {
+	BaseMessage
+	Tasks []interface{} `msg_slot:"tasks"`
+}
+
+func (self *Tasks) GetType() uint16 {
+	return MSG_TASKS_TYPE
+}
+
+func (self *Tasks) ShouldEncrypt() bool {
+	return true
+}
+
+type RemoveTask struct {
+	BaseMessage
+	TaskId string `msg_slot:"task_id"`
+}
+
+func (self *RemoveTask) GetType() uint16 {
+	return MSG_REMOVE_TASK_TYPE
+}
+
+func (self *RemoveTask) ShouldEncrypt() bool {
+	return true
+}
+
+type GetResourcePeers struct {
+	BaseMessage
+}
+
+func (self *GetResourcePeers) GetType() uint16 {
+	return MSG_GET_RESOURCE_PEERS_TYPE
+}
+
+func (self *GetResourcePeers) ShouldEncrypt() bool {
+	return true
+}
+
+type ResourcePeers struct {
+	BaseMessage
+	ResourcePeers []interface{} `msg_slot:"resource_peers"`
+}
+
+func (self *ResourcePeers) GetType() uint16 {
+	return MSG_RESOURCE_PEERS_TYPE
+}
+
+func (self *ResourcePeers) ShouldEncrypt() bool {
+	return true
+}
+
+type Degree struct {
+	BaseMessage
+	Degree uint64 `msg_slot:"degree"`
+}
+
+func (self *Degree) GetType() uint16 {
+	return MSG_DEGREE_TYPE
+}
+
+func (self *Degree) ShouldEncrypt() bool {
+	return true
+}
+
+type Gossip struct {
+	BaseMessage
+	Gossip []interface{} `msg_slot:"gossip"`
+}
+
+func (self *Gossip) GetType() uint16 {
+	return MSG_GOSSIP_TYPE
+}
+
+func (self *Gossip) ShouldEncrypt() bool {
+	return true
+}
+
+type StopGossip struct {
+	BaseMessage
+}
+
+func (self *StopGossip) GetType() uint16 {
+	return MSG_STOP_GOSSIP_TYPE
+}
+
+func (self *StopGossip) ShouldEncrypt() bool {
+	return true
+}
+
+type LocRank struct {
+	BaseMessage
+	NodeId  string      `msg_slot:"node_id"`
+	LocRank interface{} `msg_slot:"loc_rank"`
+}
+
+func (self *LocRank) GetType() uint16 {
+	return MSG_LOC_RANK_TYPE
+}
+
+func (self *LocRank) ShouldEncrypt() bool {
+	return true
+}
+
+type FindNode struct {
+	BaseMessage
+	NodeKeyId string `msg_slot:"node_key_id"`
+}
+
+func (self *FindNode) GetType() uint16 {
+	return MSG_FIND_NODE_TYPE
+}
+
+func (self *FindNode) ShouldEncrypt() bool {
+	return true
+}
+
+type WantToStartTaskSession struct {
+	BaseMessage
+	NodeInfo      map[interface{}]interface{} `msg_slot:"node_info"`
+	ConnId        string                      `msg_slot:"conn_id"`
+	SuperNodeInfo map[interface{}]interface{} `msg_slot:"super_node_info"`
+}
+
+func (self *WantToStartTaskSession) GetType() uint16 {
+	return MSG_WANT_TO_START_TASK_SESSION_TYPE
+}
+
+func (self *WantToStartTaskSession) ShouldEncrypt() bool {
+	return true
+}
+
+type SetTaskSession struct {
+	BaseMessage
+	KeyId         string                      `msg_slot:"key_id"`
+	NodeInfo      map[interface{}]interface{} `msg_slot:"node_info"`
+	ConnId        string                      `msg_slot:"conn_id"`
+	SuperNodeInfo map[interface{}]interface{} `msg_slot:"super_node_info"`
+}
+
+func (self *SetTaskSession) GetType() uint16 {
+	return MSG_SET_TASK_SESSION_TYPE
+}
+
+func (self *SetTaskSession) ShouldEncrypt() bool {
+	return true
+}
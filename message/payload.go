@@ -2,7 +2,7 @@ package message
 
 import (
 	"fmt"
-	"reflect"
+	"sort"
 
 	"github.com/golemfactory/bootstrap_go/cbor"
 )
@@ -13,23 +13,25 @@ type messageSlot = []interface{}
 // list of messageSlots
 type messagePayload = []interface{}
 
+// getSerializedPayload encodes the slots canonically, so the signed bytes
+// don't depend on the map iteration order.
 func getSerializedPayload(msg Message) ([]byte, error) {
-	payload := messagePayload{}
-	v := reflect.ValueOf(msg).Elem()
-	for i := 0; i < v.NumField(); i++ {
-		field := v.Type().Field(i)
-		val := v.Field(i)
-		tag := field.Tag.Get("msg_slot")
-		if tag != "" {
-			payload = append(payload, messageSlot{tag, val.Interface()})
-		}
+	if enc, ok := msg.(SlotEncoder); ok {
+		return cbor.SerializeCanonical(enc.EncodeSlots())
 	}
-	return cbor.Serialize(payload)
+	return cbor.SerializeCanonical(reflectEncodeSlots(msg))
+}
+
+// DecodePayload sets the fields of msg from a serialized payload, e.g.
+// kept from a received message.
+func DecodePayload(payload []byte, msg Message, opts *Options) error {
+	return deserializePayload(payload, msg, opts)
 }
 
-func deserializePayload(rawPayload []byte, msg Message) error {
+func deserializePayload(rawPayload []byte, msg Message, opts *Options) error {
+	log := opts.logger()
 	var maybeSlots interface{}
-	err := cbor.Deserialize(rawPayload, &maybeSlots)
+	err := cbor.DeserializeWithOptions(rawPayload, &maybeSlots, opts.decodeOptions())
 	if err != nil {
 		return err
 	}
@@ -42,31 +44,38 @@ func deserializePayload(rawPayload []byte, msg Message) error {
 	for _, s := range slotsList {
 		slot, ok := s.(messageSlot)
 		if !ok {
-			fmt.Printf("Couldn't cast slot %+v\n", s)
+			log.Warn("couldn't cast slot", "msg_type", msg.GetType(), "slot", s)
 			continue
 		}
 		if len(slot) != 2 {
-			fmt.Printf("Slot should be of length 2, got %+v\n", slot)
+			log.Warn("slot should be of length 2", "msg_type", msg.GetType(), "slot", slot)
 			continue
 		}
 		if slotName, ok := slot[0].(string); ok {
 			slots[slotName] = slot[1]
 		} else {
-			fmt.Printf("Expected slot name to be a string, got %+v", slot[0])
+			log.Warn("expected slot name to be a string", "msg_type", msg.GetType(), "slot_name", slot[0])
 		}
 	}
 
-	v := reflect.ValueOf(msg).Elem()
-	for i := 0; i < v.NumField(); i++ {
-		field := v.Type().Field(i)
-		val := v.Field(i)
-		tag := field.Tag.Get("msg_slot")
-		if tag != "" {
-			if vv, ok := slots[tag]; ok && vv != nil {
-				val.Set(reflect.ValueOf(vv))
+	if policy := opts.unknownSlots(); policy != UNKNOWN_SLOTS_IGNORE {
+		if unknown := unknownSlots(msg, slots); unknown != nil {
+			if policy == UNKNOWN_SLOTS_REJECT {
+				names := make([]string, 0, len(unknown))
+				for name := range unknown {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				return &SlotError{MsgType: msg.GetType(), Slot: names[0], Err: ErrUnknownSlot}
+			}
+			if setter, ok := msg.(unknownSlotsSetter); ok {
+				setter.setUnknownSlots(unknown)
 			}
 		}
 	}
 
-	return nil
+	if dec, ok := msg.(SlotDecoder); ok {
+		return dec.DecodeSlots(slots)
+	}
+	return reflectDecodeSlots(msg, slots)
 }
@@ -0,0 +1,53 @@
+package message
+
+import (
+	"fmt"
+	"sync"
+)
+
+var (
+	registeredTypes = make(map[uint16]func() Message)
+	registryMutex   sync.RWMutex
+)
+
+// Register makes the message type created by factory known to Deserialize.
+// Returns an error if the type ID is already taken.
+func Register(factory func() Message) error {
+	msg := factory()
+	if msg == nil {
+		return fmt.Errorf("message factory returned nil")
+	}
+	typ := msg.GetType()
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if _, ok := registeredTypes[typ]; ok {
+		return fmt.Errorf("message type %d is already registered", typ)
+	}
+	registeredTypes[typ] = factory
+	return nil
+}
+
+// MustRegister is like Register but panics on error. It is meant to be
+// called from init functions.
+func MustRegister(factory func() Message) {
+	if err := Register(factory); err != nil {
+		panic(err)
+	}
+}
+
+func IsRegistered(typ uint16) bool {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	_, ok := registeredTypes[typ]
+	return ok
+}
+
+func newByType(typ uint16) (Message, error) {
+	registryMutex.RLock()
+	factory, ok := registeredTypes[typ]
+	registryMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported msg type %d", typ)
+	}
+	return factory(), nil
+}
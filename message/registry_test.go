@@ -0,0 +1,91 @@
+package message_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/golemfactory/bootstrap_go/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const MSG_CUSTOM_TYPE = 31337
+
+// Custom is defined outside of the message package on purpose.
+type Custom struct {
+	message.BaseMessage
+	Text  string `msg_slot:"text"`
+	Extra []byte
+}
+
+func (self *Custom) GetType() uint16 {
+	return MSG_CUSTOM_TYPE
+}
+
+func (self *Custom) ShouldEncrypt() bool {
+	return false
+}
+
+func (self *Custom) SerializationExtraData() ([]byte, error) {
+	if self.Extra != nil {
+		return self.Extra, nil
+	}
+	return []byte{0xca, 0xfe}, nil
+}
+
+func (self *Custom) ExtraDataLen() int {
+	return 2
+}
+
+func (self *Custom) ParseExtraData(data []byte) error {
+	self.Extra = data
+	return nil
+}
+
+func newCustom() message.Message {
+	return &Custom{}
+}
+
+func init() {
+	message.MustRegister(newCustom)
+}
+
+func TestRegister(t *testing.T) {
+	assert.True(t, message.IsRegistered(MSG_CUSTOM_TYPE))
+	assert.Error(t, message.Register(newCustom))
+	assert.Error(t, message.Register(func() message.Message { return &message.Ping{} }))
+
+	sign := func([]byte) ([]byte, error) { return make([]byte, message.SIG_LEN), nil }
+	verifySign := func([]byte, []byte) bool { return true }
+	serialized, err := message.Serialize(&Custom{Text: "hi"}, nil, sign)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0xca, 0xfe}, serialized[len(serialized)-2:])
+
+	msg, err := message.Deserialize(serialized, nil, verifySign, nil)
+	require.NoError(t, err)
+	custom, ok := msg.(*Custom)
+	require.True(t, ok)
+	assert.Equal(t, "hi", custom.Text)
+	assert.Equal(t, []byte{0xca, 0xfe}, custom.Extra)
+}
+
+// The extra data must survive the reuse of the pooled frame buffer.
+func TestExtraDataBufferReuse(t *testing.T) {
+	sign := func([]byte) ([]byte, error) { return make([]byte, message.SIG_LEN), nil }
+	noEncrypt := func(data []byte) ([]byte, error) { return data, nil }
+	verifySign := func([]byte, []byte) bool { return true }
+	b := &bytes.Buffer{}
+	fw := message.NewFrameWriter(b)
+	for i := byte(1); i <= 2; i++ {
+		msg := &Custom{Extra: []byte{i, i}}
+		require.NoError(t, fw.WriteMessage(msg, time.Now(), noEncrypt, sign))
+	}
+	fr := message.NewFrameReader(b)
+	first, err := fr.ReadMessage(noEncrypt, verifySign, nil)
+	require.NoError(t, err)
+	second, err := fr.ReadMessage(noEncrypt, verifySign, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1, 1}, first.(*Custom).Extra)
+	assert.Equal(t, []byte{2, 2}, second.(*Custom).Extra)
+}
@@ -0,0 +1,66 @@
+package message
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golemfactory/bootstrap_go/clock"
+)
+
+// REPLAY_CACHE_MAX_KEYS bounds the number of remembered keys, the oldest
+// ones are forgotten first.
+const REPLAY_CACHE_MAX_KEYS = 100000
+
+type replayEntry struct {
+	key  string
+	seen time.Time
+}
+
+// ReplayCache remembers keys of received messages, e.g. their short
+// hashes, for ttl, so a captured message can't be replayed while its
+// timestamp is still fresh.
+// It is thread safe.
+type ReplayCache struct {
+	mutex   sync.Mutex
+	ttl     time.Duration
+	clock   clock.Clock
+	keys    map[string]struct{}
+	entries []replayEntry
+}
+
+func NewReplayCache(ttl time.Duration, c clock.Clock) *ReplayCache {
+	return &ReplayCache{
+		ttl:   ttl,
+		clock: c,
+		keys:  make(map[string]struct{}),
+	}
+}
+
+// Seen records the key and returns whether it was already seen within ttl.
+func (self *ReplayCache) Seen(key []byte) bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	now := self.clock.Now()
+	// entries are ordered by the time they were seen
+	expired := 0
+	for _, e := range self.entries {
+		if now.Sub(e.seen) < self.ttl {
+			break
+		}
+		delete(self.keys, e.key)
+		expired++
+	}
+	self.entries = self.entries[expired:]
+
+	k := string(key)
+	if _, ok := self.keys[k]; ok {
+		return true
+	}
+	if len(self.entries) >= REPLAY_CACHE_MAX_KEYS {
+		delete(self.keys, self.entries[0].key)
+		self.entries = self.entries[1:]
+	}
+	self.keys[k] = struct{}{}
+	self.entries = append(self.entries, replayEntry{k, now})
+	return false
+}
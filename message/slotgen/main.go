@@ -0,0 +1,226 @@
+// slotgen generates the SlotEncoder and SlotDecoder implementations of the
+// messages in a package from their msg_slot tags, so serializing them
+// doesn't need reflection.
+//
+// Usage (from the package directory):
+//
+//	go run ./slotgen -output slots_gen.go
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const HEADER = "// Code generated by slotgen. DO NOT EDIT.\n"
+
+const MESSAGE_PKG = "github.com/golemfactory/bootstrap_go/message"
+
+// decoders maps the supported field types to the message package helpers
+// converting the decoded CBOR values. interface{} fields are assigned as is.
+var decoders = map[string]string{
+	"string":                      "DecodeString",
+	"bool":                        "DecodeBool",
+	"uint64":                      "DecodeUint64",
+	"int64":                       "DecodeInt64",
+	"float64":                     "DecodeFloat64",
+	"[]byte":                      "DecodeBytes",
+	"[]interface{}":               "DecodeList",
+	"map[interface{}]interface{}": "DecodeMap",
+}
+
+type slot struct {
+	name  string
+	field string
+	// decoder is empty for interface{} fields
+	decoder string
+}
+
+type msgType struct {
+	name string
+	// message is set for structs embedding BaseMessage, which get the
+	// codecs even without slots
+	message bool
+	slots   []slot
+}
+
+func main() {
+	dir := flag.String("dir", ".", "package directory")
+	output := flag.String("output", "slots_gen.go", "output file, relative to -dir")
+	flag.Parse()
+
+	src, err := generate(*dir, *output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "slotgen:", err)
+		os.Exit(1)
+	}
+	if err := ioutil.WriteFile(filepath.Join(*dir, *output), src, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "slotgen:", err)
+		os.Exit(1)
+	}
+}
+
+// generate returns the source of the output file for the package in dir,
+// the previous output is skipped.
+func generate(dir string, output string) ([]byte, error) {
+	fset := token.NewFileSet()
+	filter := func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go") && fi.Name() != output
+	}
+	pkgs, err := parser.ParseDir(fset, dir, filter, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("expected a single package in %v, got %d", dir, len(pkgs))
+	}
+	var pkg *ast.Package
+	for _, p := range pkgs {
+		pkg = p
+	}
+
+	fileNames := make([]string, 0, len(pkg.Files))
+	for name := range pkg.Files {
+		fileNames = append(fileNames, name)
+	}
+	sort.Strings(fileNames)
+
+	aliases := make(map[string]string)
+	structs := []*ast.TypeSpec{}
+	for _, name := range fileNames {
+		for _, decl := range pkg.Files[name].Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if _, ok := ts.Type.(*ast.StructType); ok {
+					structs = append(structs, ts)
+				} else if ts.Assign.IsValid() {
+					aliases[ts.Name.Name] = typeString(fset, ts.Type)
+				}
+			}
+		}
+	}
+
+	types := []msgType{}
+	for _, ts := range structs {
+		t, err := parseStruct(fset, ts, aliases)
+		if err != nil {
+			return nil, err
+		}
+		if t.message || len(t.slots) > 0 {
+			types = append(types, t)
+		}
+	}
+
+	qual := ""
+	if pkg.Name != "message" {
+		qual = "message."
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteString(HEADER)
+	fmt.Fprintf(buf, "\npackage %s\n\n", pkg.Name)
+	if qual != "" {
+		fmt.Fprintf(buf, "import %q\n\n", MESSAGE_PKG)
+	}
+	for _, t := range types {
+		writeType(buf, t, qual)
+	}
+	return format.Source(buf.Bytes())
+}
+
+func parseStruct(fset *token.FileSet, ts *ast.TypeSpec, aliases map[string]string) (msgType, error) {
+	t := msgType{name: ts.Name.Name}
+	for _, f := range ts.Type.(*ast.StructType).Fields.List {
+		if len(f.Names) == 0 && typeString(fset, f.Type) == "BaseMessage" {
+			t.message = true
+		}
+		if f.Tag == nil {
+			continue
+		}
+		tag, err := strconv.Unquote(f.Tag.Value)
+		if err != nil {
+			return t, err
+		}
+		name := reflect.StructTag(tag).Get("msg_slot")
+		if name == "" {
+			continue
+		}
+		if len(f.Names) != 1 {
+			return t, fmt.Errorf("%v: slot %q should tag exactly one field", fset.Position(f.Pos()), name)
+		}
+		typ := typeString(fset, f.Type)
+		if alias, ok := aliases[typ]; ok {
+			typ = alias
+		}
+		s := slot{name: name, field: f.Names[0].Name}
+		if typ != "interface{}" {
+			decoder, ok := decoders[typ]
+			if !ok {
+				return t, fmt.Errorf("%v: unsupported type %v of slot %q", fset.Position(f.Pos()), typ, name)
+			}
+			s.decoder = decoder
+		}
+		t.slots = append(t.slots, s)
+	}
+	return t, nil
+}
+
+func typeString(fset *token.FileSet, expr ast.Expr) string {
+	buf := &bytes.Buffer{}
+	format.Node(buf, fset, expr)
+	return buf.String()
+}
+
+func writeType(buf *bytes.Buffer, t msgType, qual string) {
+	fmt.Fprintf(buf, "func (self *%s) EncodeSlots() []interface{} {\n", t.name)
+	if len(t.slots) == 0 {
+		buf.WriteString("return []interface{}{}\n}\n\n")
+	} else {
+		buf.WriteString("return []interface{}{\n")
+		for _, s := range t.slots {
+			fmt.Fprintf(buf, "[]interface{}{%q, self.%s},\n", s.name, s.field)
+		}
+		buf.WriteString("}\n}\n\n")
+	}
+
+	fmt.Fprintf(buf, "func (self *%s) DecodeSlots(slots map[string]interface{}) error {\n", t.name)
+	for _, s := range t.slots {
+		fmt.Fprintf(buf, "if v, ok := slots[%q]; ok && v != nil {\n", s.name)
+		if s.decoder == "" {
+			fmt.Fprintf(buf, "self.%s = v\n", s.field)
+		} else {
+			fmt.Fprintf(buf, "x, err := %s%s(v)\n", qual, s.decoder)
+			buf.WriteString("if err != nil {\n")
+			fmt.Fprintf(buf, "return &%sSlotError{MsgType: self.GetType(), Slot: %q, Err: err}\n", qual, s.name)
+			buf.WriteString("}\n")
+			fmt.Fprintf(buf, "self.%s = x\n", s.field)
+		}
+		buf.WriteString("}\n")
+	}
+	buf.WriteString("return nil\n}\n\n")
+
+	fmt.Fprintf(buf, "func (self *%s) SlotNames() []string {\n", t.name)
+	buf.WriteString("return []string{")
+	for idx, s := range t.slots {
+		if idx > 0 {
+			buf.WriteString(", ")
+		}
+		fmt.Fprintf(buf, "%q", s.name)
+	}
+	buf.WriteString("}\n}\n\n")
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeneratedUpToDate(t *testing.T) {
+	src, err := generate("..", "slots_gen.go")
+	require.NoError(t, err)
+	current, err := ioutil.ReadFile("../slots_gen.go")
+	require.NoError(t, err)
+	require.Equal(t, string(src), string(current), "run go generate in the message package")
+}
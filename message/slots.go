@@ -0,0 +1,365 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+//go:generate go run ./slotgen -output slots_gen.go
+
+// SlotEncoder is implemented by messages with slot codecs generated by
+// slotgen from the msg_slot tags, other messages are serialized with
+// reflection.
+type SlotEncoder interface {
+	// EncodeSlots returns the payload as a list of [name, value] slots.
+	EncodeSlots() []interface{}
+}
+
+// SlotDecoder is the decoding counterpart of SlotEncoder.
+type SlotDecoder interface {
+	// DecodeSlots sets the fields from the slot values by name.
+	DecodeSlots(slots map[string]interface{}) error
+	// SlotNames lists the slots declared by the message.
+	SlotNames() []string
+}
+
+// UnknownSlotsPolicy decides what happens to received slots which the
+// message doesn't declare, e.g. sent by a newer golem-messages version.
+type UnknownSlotsPolicy int
+
+const (
+	UNKNOWN_SLOTS_IGNORE UnknownSlotsPolicy = iota
+	// UNKNOWN_SLOTS_REJECT fails the decoding with ErrUnknownSlot.
+	UNKNOWN_SLOTS_REJECT
+	// UNKNOWN_SLOTS_COLLECT keeps them for diagnostics, see
+	// BaseMessage.UnknownSlots.
+	UNKNOWN_SLOTS_COLLECT
+)
+
+var ErrUnknownSlot = errors.New("unknown slot")
+
+// SlotError describes a slot which couldn't be decoded.
+type SlotError struct {
+	MsgType uint16
+	Slot    string
+	Err     error
+}
+
+func (self *SlotError) Error() string {
+	return fmt.Sprintf("message type %d, slot %q: %v", self.MsgType, self.Slot, self.Err)
+}
+
+// TypeError is returned for slot values which can't be converted to the
+// field type.
+type TypeError struct {
+	Got  interface{}
+	Want string
+}
+
+func (self *TypeError) Error() string {
+	return fmt.Sprintf("got %T, want %s", self.Got, self.Want)
+}
+
+func rangeError(v interface{}, want string) error {
+	return fmt.Errorf("%T value %v out of %s range", v, v, want)
+}
+
+// The Decode functions convert decoded CBOR slot values to field types,
+// accepting any compatible representation, e.g. a non-negative int64 as
+// uint64 or a text string as bytes.
+
+func DecodeString(v interface{}) (string, error) {
+	switch x := v.(type) {
+	case string:
+		return x, nil
+	case []byte:
+		return string(x), nil
+	}
+	return "", &TypeError{v, "string"}
+}
+
+func DecodeBool(v interface{}) (bool, error) {
+	if b, ok := v.(bool); ok {
+		return b, nil
+	}
+	return false, &TypeError{v, "bool"}
+}
+
+func DecodeUint64(v interface{}) (uint64, error) {
+	switch x := v.(type) {
+	case uint64:
+		return x, nil
+	case uint:
+		return uint64(x), nil
+	case uint32:
+		return uint64(x), nil
+	case uint16:
+		return uint64(x), nil
+	case uint8:
+		return uint64(x), nil
+	}
+	if i, ok := signedValue(v); ok {
+		if i < 0 {
+			return 0, rangeError(v, "uint64")
+		}
+		return uint64(i), nil
+	}
+	if f, ok := floatValue(v); ok {
+		if f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 {
+			return 0, rangeError(v, "uint64")
+		}
+		return uint64(f), nil
+	}
+	return 0, &TypeError{v, "uint64"}
+}
+
+func DecodeInt64(v interface{}) (int64, error) {
+	if i, ok := signedValue(v); ok {
+		return i, nil
+	}
+	switch x := v.(type) {
+	case uint64:
+		if x > math.MaxInt64 {
+			return 0, rangeError(v, "int64")
+		}
+		return int64(x), nil
+	case uint:
+		if uint64(x) > math.MaxInt64 {
+			return 0, rangeError(v, "int64")
+		}
+		return int64(x), nil
+	case uint32:
+		return int64(x), nil
+	case uint16:
+		return int64(x), nil
+	case uint8:
+		return int64(x), nil
+	}
+	if f, ok := floatValue(v); ok {
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return 0, rangeError(v, "int64")
+		}
+		return int64(f), nil
+	}
+	return 0, &TypeError{v, "int64"}
+}
+
+func DecodeFloat64(v interface{}) (float64, error) {
+	if f, ok := floatValue(v); ok {
+		return f, nil
+	}
+	if i, ok := signedValue(v); ok {
+		return float64(i), nil
+	}
+	if u, err := DecodeUint64(v); err == nil {
+		return float64(u), nil
+	}
+	return 0, &TypeError{v, "float64"}
+}
+
+func DecodeBytes(v interface{}) ([]byte, error) {
+	switch x := v.(type) {
+	case []byte:
+		return x, nil
+	case string:
+		return []byte(x), nil
+	}
+	return nil, &TypeError{v, "bytes"}
+}
+
+func DecodeList(v interface{}) ([]interface{}, error) {
+	if l, ok := v.([]interface{}); ok {
+		return l, nil
+	}
+	return nil, &TypeError{v, "list"}
+}
+
+func DecodeMap(v interface{}) (map[interface{}]interface{}, error) {
+	switch x := v.(type) {
+	case map[interface{}]interface{}:
+		return x, nil
+	case map[string]interface{}:
+		res := make(map[interface{}]interface{}, len(x))
+		for k, v := range x {
+			res[k] = v
+		}
+		return res, nil
+	}
+	return nil, &TypeError{v, "map"}
+}
+
+func signedValue(v interface{}) (int64, bool) {
+	switch x := v.(type) {
+	case int64:
+		return x, true
+	case int:
+		return int64(x), true
+	case int32:
+		return int64(x), true
+	case int16:
+		return int64(x), true
+	case int8:
+		return int64(x), true
+	}
+	return 0, false
+}
+
+func floatValue(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case float32:
+		return float64(x), true
+	}
+	return 0, false
+}
+
+// reflectEncodeSlots is the fallback for messages without a generated
+// SlotEncoder.
+func reflectEncodeSlots(msg Message) []interface{} {
+	payload := messagePayload{}
+	v := reflect.ValueOf(msg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		tag := field.Tag.Get("msg_slot")
+		if tag != "" {
+			payload = append(payload, messageSlot{tag, v.Field(i).Interface()})
+		}
+	}
+	return payload
+}
+
+// reflectDecodeSlots is the fallback for messages without a generated
+// SlotDecoder.
+func reflectDecodeSlots(msg Message, slots map[string]interface{}) error {
+	v := reflect.ValueOf(msg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		tag := field.Tag.Get("msg_slot")
+		if tag == "" {
+			continue
+		}
+		vv, ok := slots[tag]
+		if !ok || vv == nil {
+			continue
+		}
+		val, err := convertSlot(vv, field.Type)
+		if err != nil {
+			return &SlotError{MsgType: msg.GetType(), Slot: tag, Err: err}
+		}
+		v.Field(i).Set(val)
+	}
+	return nil
+}
+
+// convertSlot converts the slot value to a value of type t using the
+// Decode functions.
+func convertSlot(v interface{}, t reflect.Type) (reflect.Value, error) {
+	res := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		s, err := DecodeString(v)
+		if err != nil {
+			return res, err
+		}
+		res.SetString(s)
+		return res, nil
+	case reflect.Bool:
+		b, err := DecodeBool(v)
+		if err != nil {
+			return res, err
+		}
+		res.SetBool(b)
+		return res, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := DecodeUint64(v)
+		if err != nil {
+			return res, err
+		}
+		if res.OverflowUint(u) {
+			return res, rangeError(v, t.String())
+		}
+		res.SetUint(u)
+		return res, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := DecodeInt64(v)
+		if err != nil {
+			return res, err
+		}
+		if res.OverflowInt(i) {
+			return res, rangeError(v, t.String())
+		}
+		res.SetInt(i)
+		return res, nil
+	case reflect.Float32, reflect.Float64:
+		f, err := DecodeFloat64(v)
+		if err != nil {
+			return res, err
+		}
+		if res.OverflowFloat(f) {
+			return res, rangeError(v, t.String())
+		}
+		res.SetFloat(f)
+		return res, nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			b, err := DecodeBytes(v)
+			if err != nil {
+				return res, err
+			}
+			res.SetBytes(b)
+			return res, nil
+		}
+	case reflect.Map:
+		if m, err := DecodeMap(v); err == nil && reflect.TypeOf(m).AssignableTo(t) {
+			res.Set(reflect.ValueOf(m))
+			return res, nil
+		}
+	}
+	val := reflect.ValueOf(v)
+	if !val.Type().AssignableTo(t) {
+		return res, &TypeError{v, t.String()}
+	}
+	res.Set(val)
+	return res, nil
+}
+
+// slotNames lists the slots declared by the message.
+func slotNames(msg Message) []string {
+	if dec, ok := msg.(SlotDecoder); ok {
+		return dec.SlotNames()
+	}
+	res := []string{}
+	t := reflect.TypeOf(msg).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		if tag := t.Field(i).Tag.Get("msg_slot"); tag != "" {
+			res = append(res, tag)
+		}
+	}
+	return res
+}
+
+// unknownSlots returns the slots not declared by the message, nil if
+// there are none.
+func unknownSlots(msg Message, slots map[string]interface{}) map[string]interface{} {
+	known := slotNames(msg)
+	var res map[string]interface{}
+	for name, v := range slots {
+		found := false
+		for _, k := range known {
+			if k == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			if res == nil {
+				res = make(map[string]interface{})
+			}
+			res[name] = v
+		}
+	}
+	return res
+}
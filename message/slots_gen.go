@@ -0,0 +1,472 @@
+// Code generated by slotgen. DO NOT EDIT.
+
+package message
+
+func (self *Hello) EncodeSlots() []interface{} {
+	return []interface{}{
+		[]interface{}{"rand_val", self.RandVal},
+		[]interface{}{"proto_id", self.ProtoId},
+		[]interface{}{"node_name", self.NodeName},
+		[]interface{}{"node_info", self.NodeInfo},
+		[]interface{}{"port", self.Port},
+		[]interface{}{"client_ver", self.ClientVer},
+		[]interface{}{"client_key_id", self.ClientKeyId},
+		[]interface{}{"solve_challenge", self.SolveChallange},
+		[]interface{}{"challenge", self.Challange},
+		[]interface{}{"difficulty", self.Difficulty},
+		[]interface{}{"metadata", self.Metadata},
+		[]interface{}{"_version", self.GolemMessagesVersion},
+	}
+}
+
+func (self *Hello) DecodeSlots(slots map[string]interface{}) error {
+	if v, ok := slots["rand_val"]; ok && v != nil {
+		x, err := DecodeFloat64(v)
+		if err != nil {
+			return &SlotError{MsgType: self.GetType(), Slot: "rand_val", Err: err}
+		}
+		self.RandVal = x
+	}
+	if v, ok := slots["proto_id"]; ok && v != nil {
+		x, err := DecodeString(v)
+		if err != nil {
+			return &SlotError{MsgType: self.GetType(), Slot: "proto_id", Err: err}
+		}
+		self.ProtoId = x
+	}
+	if v, ok := slots["node_name"]; ok && v != nil {
+		x, err := DecodeString(v)
+		if err != nil {
+			return &SlotError{MsgType: self.GetType(), Slot: "node_name", Err: err}
+		}
+		self.NodeName = x
+	}
+	if v, ok := slots["node_info"]; ok && v != nil {
+		x, err := DecodeMap(v)
+		if err != nil {
+			return &SlotError{MsgType: self.GetType(), Slot: "node_info", Err: err}
+		}
+		self.NodeInfo = x
+	}
+	if v, ok := slots["port"]; ok && v != nil {
+		x, err := DecodeUint64(v)
+		if err != nil {
+			return &SlotError{MsgType: self.GetType(), Slot: "port", Err: err}
+		}
+		self.Port = x
+	}
+	if v, ok := slots["client_ver"]; ok && v != nil {
+		x, err := DecodeString(v)
+		if err != nil {
+			return &SlotError{MsgType: self.GetType(), Slot: "client_ver", Err: err}
+		}
+		self.ClientVer = x
+	}
+	if v, ok := slots["client_key_id"]; ok && v != nil {
+		x, err := DecodeString(v)
+		if err != nil {
+			return &SlotError{MsgType: self.GetType(), Slot: "client_key_id", Err: err}
+		}
+		self.ClientKeyId = x
+	}
+	if v, ok := slots["solve_challenge"]; ok && v != nil {
+		x, err := DecodeBool(v)
+		if err != nil {
+			return &SlotError{MsgType: self.GetType(), Slot: "solve_challenge", Err: err}
+		}
+		self.SolveChallange = x
+	}
+	if v, ok := slots["challenge"]; ok && v != nil {
+		self.Challange = v
+	}
+	if v, ok := slots["difficulty"]; ok && v != nil {
+		x, err := DecodeUint64(v)
+		if err != nil {
+			return &SlotError{MsgType: self.GetType(), Slot: "difficulty", Err: err}
+		}
+		self.Difficulty = x
+	}
+	if v, ok := slots["metadata"]; ok && v != nil {
+		self.Metadata = v
+	}
+	if v, ok := slots["_version"]; ok && v != nil {
+		x, err := DecodeString(v)
+		if err != nil {
+			return &SlotError{MsgType: self.GetType(), Slot: "_version", Err: err}
+		}
+		self.GolemMessagesVersion = x
+	}
+	return nil
+}
+
+func (self *Hello) SlotNames() []string {
+	return []string{"rand_val", "proto_id", "node_name", "node_info", "port", "client_ver", "client_key_id", "solve_challenge", "challenge", "difficulty", "metadata", "_version"}
+}
+
+func (self *RandVal) EncodeSlots() []interface{} {
+	return []interface{}{
+		[]interface{}{"rand_val", self.RandVal},
+	}
+}
+
+func (self *RandVal) DecodeSlots(slots map[string]interface{}) error {
+	if v, ok := slots["rand_val"]; ok && v != nil {
+		x, err := DecodeFloat64(v)
+		if err != nil {
+			return &SlotError{MsgType: self.GetType(), Slot: "rand_val", Err: err}
+		}
+		self.RandVal = x
+	}
+	return nil
+}
+
+func (self *RandVal) SlotNames() []string {
+	return []string{"rand_val"}
+}
+
+func (self *Disconnect) EncodeSlots() []interface{} {
+	return []interface{}{
+		[]interface{}{"reason", self.Reason},
+	}
+}
+
+func (self *Disconnect) DecodeSlots(slots map[string]interface{}) error {
+	if v, ok := slots["reason"]; ok && v != nil {
+		x, err := DecodeString(v)
+		if err != nil {
+			return &SlotError{MsgType: self.GetType(), Slot: "reason", Err: err}
+		}
+		self.Reason = x
+	}
+	return nil
+}
+
+func (self *Disconnect) SlotNames() []string {
+	return []string{"reason"}
+}
+
+func (self *Ping) EncodeSlots() []interface{} {
+	return []interface{}{}
+}
+
+func (self *Ping) DecodeSlots(slots map[string]interface{}) error {
+	return nil
+}
+
+func (self *Ping) SlotNames() []string {
+	return []string{}
+}
+
+func (self *Pong) EncodeSlots() []interface{} {
+	return []interface{}{}
+}
+
+func (self *Pong) DecodeSlots(slots map[string]interface{}) error {
+	return nil
+}
+
+func (self *Pong) SlotNames() []string {
+	return []string{}
+}
+
+func (self *GetPeers) EncodeSlots() []interface{} {
+	return []interface{}{}
+}
+
+func (self *GetPeers) DecodeSlots(slots map[string]interface{}) error {
+	return nil
+}
+
+func (self *GetPeers) SlotNames() []string {
+	return []string{}
+}
+
+func (self *Peers) EncodeSlots() []interface{} {
+	return []interface{}{
+		[]interface{}{"peers", self.Peers},
+	}
+}
+
+func (self *Peers) DecodeSlots(slots map[string]interface{}) error {
+	if v, ok := slots["peers"]; ok && v != nil {
+		x, err := DecodeList(v)
+		if err != nil {
+			return &SlotError{MsgType: self.GetType(), Slot: "peers", Err: err}
+		}
+		self.Peers = x
+	}
+	return nil
+}
+
+func (self *Peers) SlotNames() []string {
+	return []string{"peers"}
+}
+
+func (self *GetTasks) EncodeSlots() []interface{} {
+	return []interface{}{}
+}
+
+func (self *GetTasks) DecodeSlots(slots map[string]interface{}) error {
+	return nil
+}
+
+func (self *GetTasks) SlotNames() []string {
+	return []string{}
+}
+
+func (self *Tasks) EncodeSlots() []interface{} {
+	return []interface{}{
+		[]interface{}{"tasks", self.Tasks},
+	}
+}
+
+func (self *Tasks) DecodeSlots(slots map[string]interface{}) error {
+	if v, ok := slots["tasks"]; ok && v != nil {
+		x, err := DecodeList(v)
+		if err != nil {
+			return &SlotError{MsgType: self.GetType(), Slot: "tasks", Err: err}
+		}
+		self.Tasks = x
+	}
+	return nil
+}
+
+func (self *Tasks) SlotNames() []string {
+	return []string{"tasks"}
+}
+
+func (self *RemoveTask) EncodeSlots() []interface{} {
+	return []interface{}{
+		[]interface{}{"task_id", self.TaskId},
+	}
+}
+
+func (self *RemoveTask) DecodeSlots(slots map[string]interface{}) error {
+	if v, ok := slots["task_id"]; ok && v != nil {
+		x, err := DecodeString(v)
+		if err != nil {
+			return &SlotError{MsgType: self.GetType(), Slot: "task_id", Err: err}
+		}
+		self.TaskId = x
+	}
+	return nil
+}
+
+func (self *RemoveTask) SlotNames() []string {
+	return []string{"task_id"}
+}
+
+func (self *GetResourcePeers) EncodeSlots() []interface{} {
+	return []interface{}{}
+}
+
+func (self *GetResourcePeers) DecodeSlots(slots map[string]interface{}) error {
+	return nil
+}
+
+func (self *GetResourcePeers) SlotNames() []string {
+	return []string{}
+}
+
+func (self *ResourcePeers) EncodeSlots() []interface{} {
+	return []interface{}{
+		[]interface{}{"resource_peers", self.ResourcePeers},
+	}
+}
+
+func (self *ResourcePeers) DecodeSlots(slots map[string]interface{}) error {
+	if v, ok := slots["resource_peers"]; ok && v != nil {
+		x, err := DecodeList(v)
+		if err != nil {
+			return &SlotError{MsgType: self.GetType(), Slot: "resource_peers", Err: err}
+		}
+		self.ResourcePeers = x
+	}
+	return nil
+}
+
+func (self *ResourcePeers) SlotNames() []string {
+	return []string{"resource_peers"}
+}
+
+func (self *Degree) EncodeSlots() []interface{} {
+	return []interface{}{
+		[]interface{}{"degree", self.Degree},
+	}
+}
+
+func (self *Degree) DecodeSlots(slots map[string]interface{}) error {
+	if v, ok := slots["degree"]; ok && v != nil {
+		x, err := DecodeUint64(v)
+		if err != nil {
+			return &SlotError{MsgType: self.GetType(), Slot: "degree", Err: err}
+		}
+		self.Degree = x
+	}
+	return nil
+}
+
+func (self *Degree) SlotNames() []string {
+	return []string{"degree"}
+}
+
+func (self *Gossip) EncodeSlots() []interface{} {
+	return []interface{}{
+		[]interface{}{"gossip", self.Gossip},
+	}
+}
+
+func (self *Gossip) DecodeSlots(slots map[string]interface{}) error {
+	if v, ok := slots["gossip"]; ok && v != nil {
+		x, err := DecodeList(v)
+		if err != nil {
+			return &SlotError{MsgType: self.GetType(), Slot: "gossip", Err: err}
+		}
+		self.Gossip = x
+	}
+	return nil
+}
+
+func (self *Gossip) SlotNames() []string {
+	return []string{"gossip"}
+}
+
+func (self *StopGossip) EncodeSlots() []interface{} {
+	return []interface{}{}
+}
+
+func (self *StopGossip) DecodeSlots(slots map[string]interface{}) error {
+	return nil
+}
+
+func (self *StopGossip) SlotNames() []string {
+	return []string{}
+}
+
+func (self *LocRank) EncodeSlots() []interface{} {
+	return []interface{}{
+		[]interface{}{"node_id", self.NodeId},
+		[]interface{}{"loc_rank", self.LocRank},
+	}
+}
+
+func (self *LocRank) DecodeSlots(slots map[string]interface{}) error {
+	if v, ok := slots["node_id"]; ok && v != nil {
+		x, err := DecodeString(v)
+		if err != nil {
+			return &SlotError{MsgType: self.GetType(), Slot: "node_id", Err: err}
+		}
+		self.NodeId = x
+	}
+	if v, ok := slots["loc_rank"]; ok && v != nil {
+		self.LocRank = v
+	}
+	return nil
+}
+
+func (self *LocRank) SlotNames() []string {
+	return []string{"node_id", "loc_rank"}
+}
+
+func (self *FindNode) EncodeSlots() []interface{} {
+	return []interface{}{
+		[]interface{}{"node_key_id", self.NodeKeyId},
+	}
+}
+
+func (self *FindNode) DecodeSlots(slots map[string]interface{}) error {
+	if v, ok := slots["node_key_id"]; ok && v != nil {
+		x, err := DecodeString(v)
+		if err != nil {
+			return &SlotError{MsgType: self.GetType(), Slot: "node_key_id", Err: err}
+		}
+		self.NodeKeyId = x
+	}
+	return nil
+}
+
+func (self *FindNode) SlotNames() []string {
+	return []string{"node_key_id"}
+}
+
+func (self *WantToStartTaskSession) EncodeSlots() []interface{} {
+	return []interface{}{
+		[]interface{}{"node_info", self.NodeInfo},
+		[]interface{}{"conn_id", self.ConnId},
+		[]interface{}{"super_node_info", self.SuperNodeInfo},
+	}
+}
+
+func (self *WantToStartTaskSession) DecodeSlots(slots map[string]interface{}) error {
+	if v, ok := slots["node_info"]; ok && v != nil {
+		x, err := DecodeMap(v)
+		if err != nil {
+			return &SlotError{MsgType: self.GetType(), Slot: "node_info", Err: err}
+		}
+		self.NodeInfo = x
+	}
+	if v, ok := slots["conn_id"]; ok && v != nil {
+		x, err := DecodeString(v)
+		if err != nil {
+			return &SlotError{MsgType: self.GetType(), Slot: "conn_id", Err: err}
+		}
+		self.ConnId = x
+	}
+	if v, ok := slots["super_node_info"]; ok && v != nil {
+		x, err := DecodeMap(v)
+		if err != nil {
+			return &SlotError{MsgType: self.GetType(), Slot: "super_node_info", Err: err}
+		}
+		self.SuperNodeInfo = x
+	}
+	return nil
+}
+
+func (self *WantToStartTaskSession) SlotNames() []string {
+	return []string{"node_info", "conn_id", "super_node_info"}
+}
+
+func (self *SetTaskSession) EncodeSlots() []interface{} {
+	return []interface{}{
+		[]interface{}{"key_id", self.KeyId},
+		[]interface{}{"node_info", self.NodeInfo},
+		[]interface{}{"conn_id", self.ConnId},
+		[]interface{}{"super_node_info", self.SuperNodeInfo},
+	}
+}
+
+func (self *SetTaskSession) DecodeSlots(slots map[string]interface{}) error {
+	if v, ok := slots["key_id"]; ok && v != nil {
+		x, err := DecodeString(v)
+		if err != nil {
+			return &SlotError{MsgType: self.GetType(), Slot: "key_id", Err: err}
+		}
+		self.KeyId = x
+	}
+	if v, ok := slots["node_info"]; ok && v != nil {
+		x, err := DecodeMap(v)
+		if err != nil {
+			return &SlotError{MsgType: self.GetType(), Slot: "node_info", Err: err}
+		}
+		self.NodeInfo = x
+	}
+	if v, ok := slots["conn_id"]; ok && v != nil {
+		x, err := DecodeString(v)
+		if err != nil {
+			return &SlotError{MsgType: self.GetType(), Slot: "conn_id", Err: err}
+		}
+		self.ConnId = x
+	}
+	if v, ok := slots["super_node_info"]; ok && v != nil {
+		x, err := DecodeMap(v)
+		if err != nil {
+			return &SlotError{MsgType: self.GetType(), Slot: "super_node_info", Err: err}
+		}
+		self.SuperNodeInfo = x
+	}
+	return nil
+}
+
+func (self *SetTaskSession) SlotNames() []string {
+	return []string{"key_id", "node_info", "conn_id", "super_node_info"}
+}
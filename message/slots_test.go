@@ -0,0 +1,244 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/golemfactory/bootstrap_go/cbor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sampleHello() *Hello {
+	return &Hello{
+		RandVal:     0.25,
+		ProtoId:     "1337",
+		NodeName:    "node",
+		NodeInfo:    map[interface{}]interface{}{"key": "deadbeef", "port": uint64(40102)},
+		Port:        40102,
+		ClientVer:   "0.17.0",
+		ClientKeyId: "deadbeef",
+		Challange:   "challenge",
+		Difficulty:  7,
+		Metadata:    map[interface{}]interface{}{},
+
+		GolemMessagesVersion: "2.15.0",
+	}
+}
+
+func sampleMessages() []Message {
+	res := []Message{sampleHello()}
+	for _, factory := range registeredTypes {
+		res = append(res, factory())
+	}
+	return res
+}
+
+func TestGeneratedSlotsMatchReflection(t *testing.T) {
+	for _, msg := range sampleMessages() {
+		enc, ok := msg.(SlotEncoder)
+		if !ok {
+			// registered by the tests
+			continue
+		}
+		generated, err := cbor.Serialize(enc.EncodeSlots())
+		require.NoError(t, err)
+		reflected, err := cbor.Serialize(reflectEncodeSlots(msg))
+		require.NoError(t, err)
+		assert.Equal(t, reflected, generated)
+
+		fromGenerated, err := newByType(msg.GetType())
+		require.NoError(t, err)
+		require.NoError(t, deserializePayload(generated, fromGenerated, nil))
+		fromReflection, err := newByType(msg.GetType())
+		require.NoError(t, err)
+		var slots interface{}
+		require.NoError(t, cbor.Deserialize(reflected, &slots))
+		slotMap := make(map[string]interface{})
+		for _, s := range slots.([]interface{}) {
+			slot := s.([]interface{})
+			slotMap[slot[0].(string)] = slot[1]
+		}
+		require.NoError(t, reflectDecodeSlots(fromReflection, slotMap))
+		assert.Equal(t, fromReflection, fromGenerated)
+	}
+}
+
+func TestDecodeSlotsTypeError(t *testing.T) {
+	payload, err := cbor.Serialize([]interface{}{
+		[]interface{}{"port", "40102"},
+	})
+	require.NoError(t, err)
+	err = deserializePayload(payload, &Hello{}, nil)
+	require.Error(t, err)
+	assert.Equal(t, `message type 0, slot "port": got string, want uint64`, err.Error())
+	slotErr, ok := err.(*SlotError)
+	require.True(t, ok)
+	assert.Equal(t, uint16(MSG_HELLO_TYPE), slotErr.MsgType)
+	assert.Equal(t, "port", slotErr.Slot)
+	typeErr, ok := slotErr.Err.(*TypeError)
+	require.True(t, ok)
+	assert.Equal(t, "40102", typeErr.Got)
+	assert.Equal(t, "uint64", typeErr.Want)
+
+	err = reflectDecodeSlots(&Hello{}, map[string]interface{}{"port": "40102"})
+	require.Error(t, err)
+	assert.Equal(t, `message type 0, slot "port": got string, want uint64`, err.Error())
+
+	err = reflectDecodeSlots(&Hello{}, map[string]interface{}{"port": int64(-1)})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "out of uint64 range")
+}
+
+func TestDecodeNumericCoercion(t *testing.T) {
+	for _, v := range []interface{}{uint64(7), uint8(7), int64(7), int(7), float64(7), float32(7)} {
+		u, err := DecodeUint64(v)
+		require.NoError(t, err, "%T", v)
+		assert.Equal(t, uint64(7), u)
+		i, err := DecodeInt64(v)
+		require.NoError(t, err, "%T", v)
+		assert.Equal(t, int64(7), i)
+		f, err := DecodeFloat64(v)
+		require.NoError(t, err, "%T", v)
+		assert.Equal(t, float64(7), f)
+	}
+	for _, v := range []interface{}{int64(-1), 1.5, float32(-2), "7"} {
+		_, err := DecodeUint64(v)
+		assert.Error(t, err, "%T %v", v, v)
+	}
+	_, err := DecodeInt64(uint64(1 << 63))
+	assert.Error(t, err)
+
+	s, err := DecodeString([]byte("abc"))
+	require.NoError(t, err)
+	assert.Equal(t, "abc", s)
+	b, err := DecodeBytes("abc")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("abc"), b)
+	m, err := DecodeMap(map[string]interface{}{"a": uint64(1)})
+	require.NoError(t, err)
+	assert.Equal(t, map[interface{}]interface{}{"a": uint64(1)}, m)
+}
+
+type coercedMessage struct {
+	BaseMessage
+	Port    uint16           `msg_slot:"port"`
+	Offset  int32            `msg_slot:"offset"`
+	RandVal float32          `msg_slot:"rand_val"`
+	Reason  DisconnectReason `msg_slot:"reason"`
+	Key     []byte           `msg_slot:"key"`
+}
+
+func (self *coercedMessage) GetType() uint16 {
+	return 31338
+}
+
+func (self *coercedMessage) ShouldEncrypt() bool {
+	return false
+}
+
+func TestReflectDecodeCoercion(t *testing.T) {
+	msg := &coercedMessage{}
+	require.NoError(t, reflectDecodeSlots(msg, map[string]interface{}{
+		"port":     int64(40102),
+		"offset":   uint64(3),
+		"rand_val": 0.5,
+		"reason":   []byte("timeout"),
+		"key":      "abc",
+	}))
+	assert.Equal(t, uint16(40102), msg.Port)
+	assert.Equal(t, int32(3), msg.Offset)
+	assert.Equal(t, float32(0.5), msg.RandVal)
+	assert.Equal(t, DISCONNECT_TIMEOUT, msg.Reason)
+	assert.Equal(t, []byte("abc"), msg.Key)
+
+	err := reflectDecodeSlots(&coercedMessage{}, map[string]interface{}{"port": uint64(1 << 16)})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "out of uint16 range")
+}
+
+func TestUnknownSlots(t *testing.T) {
+	payload, err := cbor.Serialize([]interface{}{
+		[]interface{}{"reason", "timeout"},
+		[]interface{}{"extra_b", uint64(2)},
+		[]interface{}{"extra_a", "a"},
+	})
+	require.NoError(t, err)
+
+	msg := &Disconnect{}
+	require.NoError(t, deserializePayload(payload, msg, nil))
+	assert.Equal(t, DISCONNECT_TIMEOUT, msg.Reason)
+	assert.Nil(t, msg.UnknownSlots())
+
+	msg = &Disconnect{}
+	err = deserializePayload(payload, msg, &Options{UnknownSlots: UNKNOWN_SLOTS_REJECT})
+	require.Error(t, err)
+	assert.Equal(t, `message type 2, slot "extra_a": unknown slot`, err.Error())
+	assert.Equal(t, ErrUnknownSlot, err.(*SlotError).Err)
+
+	msg = &Disconnect{}
+	require.NoError(t, deserializePayload(payload, msg, &Options{UnknownSlots: UNKNOWN_SLOTS_COLLECT}))
+	assert.Equal(t, DISCONNECT_TIMEOUT, msg.Reason)
+	assert.Equal(t, map[string]interface{}{"extra_a": "a", "extra_b": uint64(2)}, msg.UnknownSlots())
+
+	coerced := &coercedMessage{}
+	require.NoError(t, deserializePayload(payload, coerced, &Options{UnknownSlots: UNKNOWN_SLOTS_COLLECT}))
+	assert.Equal(t, DISCONNECT_TIMEOUT, coerced.Reason)
+	assert.Equal(t, map[string]interface{}{"extra_a": "a", "extra_b": uint64(2)}, coerced.UnknownSlots())
+}
+
+func TestReceivedShortHash(t *testing.T) {
+	var signed []byte
+	sign := func(shortHash []byte) ([]byte, error) {
+		signed = shortHash
+		return make([]byte, SIG_LEN), nil
+	}
+	frame, err := Serialize(sampleHello(), noEncrypt, sign)
+	require.NoError(t, err)
+	msg, err := Deserialize(frame, noEncrypt, fakeVerifySign, nil)
+	require.NoError(t, err)
+	assert.Equal(t, signed, msg.(*Hello).ShortHash())
+}
+
+func benchmarkEncode(b *testing.B, encode func(Message) []interface{}) {
+	msg := sampleHello()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := cbor.Serialize(encode(msg)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReflectEncodeSlots(b *testing.B) {
+	benchmarkEncode(b, reflectEncodeSlots)
+}
+
+func BenchmarkGeneratedEncodeSlots(b *testing.B) {
+	benchmarkEncode(b, func(msg Message) []interface{} {
+		return msg.(SlotEncoder).EncodeSlots()
+	})
+}
+
+func benchmarkDecode(b *testing.B, decode func(Message, map[string]interface{}) error) {
+	slots := make(map[string]interface{})
+	for _, s := range reflectEncodeSlots(sampleHello()) {
+		slot := s.([]interface{})
+		slots[slot[0].(string)] = slot[1]
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := decode(&Hello{}, slots); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReflectDecodeSlots(b *testing.B) {
+	benchmarkDecode(b, reflectDecodeSlots)
+}
+
+func BenchmarkGeneratedDecodeSlots(b *testing.B) {
+	benchmarkDecode(b, func(msg Message, slots map[string]interface{}) error {
+		return msg.(SlotDecoder).DecodeSlots(slots)
+	})
+}
@@ -0,0 +1,137 @@
+#!/usr/bin/env python3
+"""Captures golden vectors for message/golden_test.go.
+
+Run it once per supported golem-messages version (2.24.x-2.26.x), in a
+virtualenv with that version and cbor2:
+
+    pip install golem-messages==2.24.3 cbor2
+    python3 capture.py
+
+Every message is written to <golem-messages version>_<name>.json next to
+this script. A vector holds the frame produced by golem_messages.dump
+(without the 4 byte length prefix), the keys needed to decrypt and verify
+it, the expected slot values and whether the payload is encoded the way
+cbor2 does with canonical=True, so the Go package must reproduce it.
+"""
+
+import enum
+import json
+import os
+
+import cbor2
+import golem_messages
+from golem_messages import message
+from golem_messages.cryptography import ECCx
+
+# Disconnect reasons sent by the bootstrap, see sentDisconnectReasons in
+# golden_test.go. A reason unknown to golem-messages raises ValueError.
+DISCONNECT_REASONS = ['protocol_version', 'unverified', 'bootstrap', 'timeout']
+
+# Fixed keys so the vectors can be regenerated and compared.
+SENDER = ECCx(bytes.fromhex('11' * 32))
+RECEIVER = ECCx(bytes.fromhex('22' * 32))
+
+NODE_INFO = {
+    'node_name': 'golden',
+    'key': SENDER.raw_pubkey.hex(),
+    'prv_port': 40102,
+    'pub_port': 40102,
+    'p2p_prv_port': 40102,
+    'p2p_pub_port': 40102,
+    'prv_addr': '10.0.0.1',
+    'pub_addr': '1.2.3.4',
+    'prv_addresses': ['10.0.0.1', '172.17.0.1'],
+    'nat_type': [],
+}
+
+
+def node_info():
+    try:
+        from golem_messages.datastructures.p2p import Node
+    except ImportError:
+        return dict(NODE_INFO)
+    return Node(**NODE_INFO)
+
+
+def messages():
+    yield 'hello', message.base.Hello(
+        rand_val=0.25,
+        proto_id='31',
+        node_name='golden',
+        node_info=node_info(),
+        port=40102,
+        client_ver='0.19.0',
+        client_key_id=SENDER.raw_pubkey.hex(),
+        solve_challenge=False,
+        challenge=None,
+        difficulty=0,
+        metadata={},
+    )
+    yield 'rand_val', message.base.RandVal(rand_val=0.25)
+    yield 'disconnect', message.base.Disconnect(
+        reason=message.base.Disconnect.REASON.Bootstrap,
+    )
+    for reason in DISCONNECT_REASONS:
+        yield 'disconnect_' + reason, message.base.Disconnect(
+            reason=message.base.Disconnect.REASON(reason),
+        )
+    yield 'peers', message.p2p.Peers(peers=[{
+        'address': '1.2.3.4',
+        'port': 40102,
+        'node': dict(NODE_INFO),
+        'node_name': 'golden',
+    }])
+
+
+def jsonable(value):
+    if isinstance(value, enum.Enum):
+        return value.value
+    if isinstance(value, bytes):
+        return value.hex()
+    if isinstance(value, dict):
+        return {str(k): jsonable(v) for k, v in value.items()}
+    if isinstance(value, (list, tuple)):
+        return [jsonable(v) for v in value]
+    if hasattr(value, 'to_dict'):
+        return jsonable(value.to_dict())
+    return value
+
+
+def is_canonical(msg, frame):
+    """Whether the payload of the frame is canonical CBOR."""
+    # header (11 bytes) and signature (65 bytes) come first, the Hello is
+    # followed by the 32 bytes of the version
+    payload = frame[76:]
+    if isinstance(msg, message.base.Hello):
+        payload = payload[:-32]
+    if msg.ENCRYPT:
+        payload = RECEIVER.decrypt(payload)
+    return cbor2.dumps(cbor2.loads(payload), canonical=True) == payload
+
+
+def main():
+    version = golem_messages.__version__
+    directory = os.path.dirname(os.path.abspath(__file__))
+    for name, msg in messages():
+        frame = golem_messages.dump(
+            msg, SENDER.raw_privkey, RECEIVER.raw_pubkey)
+        vector = {
+            'golem_messages_version': version,
+            'type': msg.TYPE,
+            'frame': frame.hex(),
+            'sender_public_key': SENDER.raw_pubkey.hex(),
+            'receiver_private_key': RECEIVER.raw_privkey.hex(),
+            'canonical': is_canonical(msg, frame),
+            'slots': {
+                slot: jsonable(getattr(msg, slot))
+                for slot in msg.__slots__
+            },
+        }
+        path = os.path.join(directory, '%s_%s.json' % (version, name))
+        with open(path, 'w') as f:
+            json.dump(vector, f, indent=2, sort_keys=True)
+            f.write('\n')
+
+
+if __name__ == '__main__':
+    main()
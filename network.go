@@ -0,0 +1,63 @@
+package bootstrap
+
+import (
+	"fmt"
+
+	"github.com/golemfactory/bootstrap_go/ban"
+	"github.com/golemfactory/bootstrap_go/message"
+	"github.com/golemfactory/bootstrap_go/peerkeeper"
+	"github.com/golemfactory/bootstrap_go/semver"
+)
+
+// Network is a Golem network (e.g. mainnet or testnet) served by
+// the bootstrap on its own port. Peers are never shared between networks.
+type Network struct {
+	ProtocolId string
+	Port       uint64
+	// PeerNum is the maximal number of peers sent to a client.
+	PeerNum                       int
+	GolemMessagesVersion          string
+	GolemVersion                  string
+	AcceptedGolemMessagesVersions []semver.Range
+	AcceptedGolemVersions         []semver.Range
+	PeerKeeper                    peerkeeper.PeerKeeper
+}
+
+// primaryNetwork is the network described by the top level Config fields.
+func primaryNetwork(config *Config, pk peerkeeper.PeerKeeper) Network {
+	return Network{
+		ProtocolId:                    config.ProtocolId,
+		Port:                          config.Port,
+		PeerNum:                       config.PeerNum,
+		GolemMessagesVersion:          config.GolemMessagesVersion,
+		GolemVersion:                  config.GolemVersion,
+		AcceptedGolemMessagesVersions: config.AcceptedGolemMessagesVersions,
+		AcceptedGolemVersions:         config.AcceptedGolemVersions,
+		PeerKeeper:                    pk,
+	}
+}
+
+// AddNetwork makes the service serve one more network besides the one
+// described by Config. It should be called before Listen.
+func (s *Service) AddNetwork(n Network) error {
+	if n.PeerKeeper == nil {
+		return fmt.Errorf("network %v has no PeerKeeper", n.ProtocolId)
+	}
+	if len(n.GolemMessagesVersion) > message.HELLO_MAX_VERSION_LEN {
+		return fmt.Errorf("golem-messages version %q of network %v longer than %d bytes",
+			n.GolemMessagesVersion, n.ProtocolId, message.HELLO_MAX_VERSION_LEN)
+	}
+	for _, other := range s.networks {
+		if other.ProtocolId == n.ProtocolId {
+			return fmt.Errorf("network %v is already served", n.ProtocolId)
+		}
+		if other.Port == n.Port {
+			return fmt.Errorf("port %d is already used by network %v", n.Port, other.ProtocolId)
+		}
+	}
+	if s.config.Bans != nil {
+		n.PeerKeeper = ban.NewPeerKeeper(n.PeerKeeper, s.config.Bans)
+	}
+	s.networks = append(s.networks, &n)
+	return nil
+}
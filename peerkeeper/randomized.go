@@ -4,18 +4,31 @@ import (
 	"sync"
 
 	"github.com/golemfactory/bootstrap_go/python"
+	"github.com/golemfactory/bootstrap_go/random"
 )
 
 type RandomizedPeerKeeper struct {
-	peers   map[string]python.Peer
+	peers map[string]python.Peer
+	// ids keeps the insertion order so that, for a given Rand, eviction
+	// and GetPeers results don't depend on the map iteration order.
+	ids     []string
 	peerNum int
+	rand    random.Rand
 	mutex   sync.Mutex
 }
 
 func NewRandomizedPeerKeeper(peerNum int) *RandomizedPeerKeeper {
+	return NewRandomizedPeerKeeperWithRand(peerNum, random.Secure())
+}
+
+// NewRandomizedPeerKeeperWithRand creates a keeper evicting peers chosen
+// by r, e.g. a seeded one in tests.
+func NewRandomizedPeerKeeperWithRand(peerNum int, r random.Rand) *RandomizedPeerKeeper {
 	return &RandomizedPeerKeeper{
 		peers:   make(map[string]python.Peer),
+		ids:     make([]string, 0, peerNum),
 		peerNum: peerNum,
+		rand:    r,
 		mutex:   sync.Mutex{},
 	}
 }
@@ -26,25 +39,30 @@ func (pk *RandomizedPeerKeeper) AddPeer(id string, peer python.Peer) {
 	if _, ok := pk.peers[id]; ok {
 		return
 	}
-	if len(pk.peers) >= pk.peerNum {
-		// remove a random peer and since map iteration order is random
-		// we can remove the first peer we encounter
-		for id, _ := range pk.peers {
-			delete(pk.peers, id)
-			break
-		}
+	if len(pk.ids) > 0 && len(pk.ids) >= pk.peerNum {
+		idx := pk.rand.Intn(len(pk.ids))
+		delete(pk.peers, pk.ids[idx])
+		last := len(pk.ids) - 1
+		pk.ids[idx] = pk.ids[last]
+		pk.ids = pk.ids[:last]
 	}
 	pk.peers[id] = peer
+	pk.ids = append(pk.ids, id)
 }
 
+// GetPeers returns the peers other than peerId in a random order, so
+// callers sending a part of them hand out different peers each time.
 func (pk *RandomizedPeerKeeper) GetPeers(peerId string) []python.Peer {
 	pk.mutex.Lock()
 	defer pk.mutex.Unlock()
-	peers := make([]python.Peer, 0, len(pk.peers))
-	for id, p := range pk.peers {
+	peers := make([]python.Peer, 0, len(pk.ids))
+	for _, id := range pk.ids {
 		if id != peerId {
-			peers = append(peers, p)
+			peers = append(peers, pk.peers[id])
 		}
 	}
+	random.Shuffle(pk.rand, len(peers), func(i, j int) {
+		peers[i], peers[j] = peers[j], peers[i]
+	})
 	return peers
 }
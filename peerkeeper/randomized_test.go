@@ -1,9 +1,11 @@
 package peerkeeper
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/golemfactory/bootstrap_go/python"
+	"github.com/golemfactory/bootstrap_go/random"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -36,3 +38,43 @@ func TestRandomizedPeerKeeper(t *testing.T) {
 		t.Errorf("Expected peer3 to be in the list, got %v", peers)
 	}
 }
+
+func TestRandomizedPeerKeeperDeterministic(t *testing.T) {
+	run := func() []string {
+		pk := NewRandomizedPeerKeeperWithRand(3, random.NewSeeded(1))
+		for i := 0; i < 10; i++ {
+			name := fmt.Sprintf("peer%d", i)
+			pk.AddPeer(name, python.Peer{NodeName: name})
+		}
+		names := make([]string, 0)
+		for _, p := range pk.GetPeers("") {
+			names = append(names, p.NodeName)
+		}
+		return names
+	}
+	first := run()
+	require.Equal(t, 3, len(first))
+	assert.Contains(t, first, "peer9")
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, first, run())
+	}
+}
+
+func TestRandomizedPeerKeeperShuffles(t *testing.T) {
+	pk := NewRandomizedPeerKeeperWithRand(10, random.NewSeeded(1))
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("peer%d", i)
+		pk.AddPeer(name, python.Peer{NodeName: name})
+	}
+	// the first peers are the ones sent when the list is cut
+	firsts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		peers := pk.GetPeers("")
+		require.Equal(t, 10, len(peers))
+		firsts[peers[0].NodeName]++
+	}
+	assert.Equal(t, 10, len(firsts))
+	for name, n := range firsts {
+		assert.True(t, n > 50, "%v first %d times out of 1000", name, n)
+	}
+}
@@ -0,0 +1,143 @@
+package bootstrap
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/golemfactory/bootstrap_go/python"
+)
+
+// Limits of the peer record fields, longer records aren't stored.
+const (
+	MAX_NODE_NAME_LEN = 256
+	MAX_VERSION_LEN   = 64
+	MAX_PRV_ADDRESSES = 16
+	// MAX_RECORD_LEN bounds the signed Hello kept with a peer, longer
+	// ones are dropped but the peer is stored.
+	MAX_RECORD_LEN = 4096
+)
+
+// Reasons of the PeerDecision.
+const (
+	PEER_STORED            = "stored"
+	PEER_PUB_ADDR_REPLACED = "pub_addr_replaced"
+	PEER_PORT_ZERO         = "port_zero"
+	PEER_FIELD_TOO_LONG    = "field_too_long"
+	PEER_INVALID_NODE      = "invalid_node"
+	PEER_RESERVED_ADDRESS  = "reserved_address"
+	PEER_VETOED            = "vetoed"
+)
+
+// PeerDecision records whether the peer of a session was stored in the
+// PeerKeeper and why.
+type PeerDecision struct {
+	Stored bool
+	// Reason is one of the PEER_* constants.
+	Reason string
+	// Detail describes the reason, e.g. the offending field.
+	Detail string
+}
+
+// reservedNets are the ranges which aren't publicly routable, besides the
+// loopback, link-local, multicast and unspecified addresses.
+var reservedNets = parseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"240.0.0.0/4",
+	"fc00::/7",
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	res := make([]*net.IPNet, len(cidrs))
+	for idx, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		res[idx] = n
+	}
+	return res
+}
+
+func isReservedIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsMulticast() {
+		return true
+	}
+	for _, n := range reservedNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizePeer checks the record declared by the peer before it's stored
+// and passed to other peers. The declared public address is replaced with
+// the observed one, so peers can't point others at a third party.
+func (s *Service) sanitizePeer(peer python.Peer) (python.Peer, PeerDecision) {
+	reject := func(reason string, format string, args ...interface{}) (python.Peer, PeerDecision) {
+		return peer, PeerDecision{Reason: reason, Detail: fmt.Sprintf(format, args...)}
+	}
+	if peer.Port == 0 {
+		return reject(PEER_PORT_ZERO, "listening port not declared")
+	}
+	lengths := []struct {
+		name  string
+		value string
+		max   int
+	}{
+		{"node_name", peer.NodeName, MAX_NODE_NAME_LEN},
+		{"client_ver", peer.ClientVer, MAX_VERSION_LEN},
+		{"golem_messages_version", peer.GolemMessagesVersion, MAX_VERSION_LEN},
+	}
+	if peer.Node != nil {
+		lengths = append(lengths, struct {
+			name  string
+			value string
+			max   int
+		}{"node.node_name", peer.Node.NodeName, MAX_NODE_NAME_LEN})
+	}
+	for _, l := range lengths {
+		if len(l.value) > l.max {
+			return reject(PEER_FIELD_TOO_LONG, "%v of %d bytes exceeds %d", l.name, len(l.value), l.max)
+		}
+	}
+	if peer.Node == nil {
+		return reject(PEER_INVALID_NODE, "missing node")
+	}
+	if n := len(peer.Node.PrvAddresses); n > MAX_PRV_ADDRESSES {
+		return reject(PEER_FIELD_TOO_LONG, "%d prv_addresses exceed %d", n, MAX_PRV_ADDRESSES)
+	}
+	if err := peer.Node.Validate(); err != nil {
+		return reject(PEER_INVALID_NODE, "%v", err)
+	}
+	if peer.Record != nil && len(peer.Record.Payload) > MAX_RECORD_LEN {
+		// stored without the record rather than amplified to everyone
+		peer.Record = nil
+	}
+
+	observed := hostIP(peer.Address)
+	if observed == nil {
+		// not an IP transport, nothing to compare with
+		return peer, PeerDecision{Stored: true, Reason: PEER_STORED}
+	}
+	if isReservedIP(observed) && !s.config.AllowReservedAddresses {
+		return reject(PEER_RESERVED_ADDRESS, "connected from %v", observed)
+	}
+	decision := PeerDecision{Stored: true, Reason: PEER_STORED}
+	if declared := hostIP(peer.Node.PubAddr); declared == nil || !declared.Equal(observed) {
+		if peer.Node.PubAddr != "" {
+			decision.Reason = PEER_PUB_ADDR_REPLACED
+			decision.Detail = fmt.Sprintf("declared %v, connected from %v", peer.Node.PubAddr, observed)
+		}
+		// the node is shared with the session
+		node := *peer.Node
+		node.PubAddr = observed.String()
+		peer.Node = &node
+	}
+	return peer, decision
+}
@@ -0,0 +1,114 @@
+package bootstrap
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/golemfactory/bootstrap_go/message"
+	"github.com/golemfactory/bootstrap_go/python"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var TEST_NODE_KEY = strings.Repeat("ab", 64)
+
+func TestSanitizePeer(t *testing.T) {
+	service := getService(t, getConfig(), NewTestPeerKeeper())
+	valid := func() python.Peer {
+		return python.Peer{
+			Address:  "203.0.113.7",
+			Port:     40102,
+			NodeName: "node",
+			Node:     &python.Node{NodeName: "node", Key: TEST_NODE_KEY, PubAddr: "203.0.113.7", PrvAddresses: []string{"10.0.0.7"}},
+		}
+	}
+
+	peer, decision := service.sanitizePeer(valid())
+	assert.Equal(t, PeerDecision{Stored: true, Reason: PEER_STORED}, decision)
+	assert.Equal(t, valid(), peer)
+
+	cases := []struct {
+		name   string
+		modify func(p *python.Peer)
+		reason string
+	}{
+		{"port zero", func(p *python.Peer) { p.Port = 0 }, PEER_PORT_ZERO},
+		{"long name", func(p *python.Peer) { p.NodeName = strings.Repeat("a", MAX_NODE_NAME_LEN+1) }, PEER_FIELD_TOO_LONG},
+		{"long node name", func(p *python.Peer) { p.Node.NodeName = strings.Repeat("a", MAX_NODE_NAME_LEN+1) }, PEER_FIELD_TOO_LONG},
+		{"long version", func(p *python.Peer) { p.ClientVer = strings.Repeat("1", MAX_VERSION_LEN+1) }, PEER_FIELD_TOO_LONG},
+		{"many addresses", func(p *python.Peer) {
+			p.Node.PrvAddresses = make([]string, MAX_PRV_ADDRESSES+1)
+			for i := range p.Node.PrvAddresses {
+				p.Node.PrvAddresses[i] = "10.0.0.1"
+			}
+		}, PEER_FIELD_TOO_LONG},
+		{"no node", func(p *python.Peer) { p.Node = nil }, PEER_INVALID_NODE},
+		{"invalid node", func(p *python.Peer) { p.Node.PubPort = 1 << 16 }, PEER_INVALID_NODE},
+		{"short key", func(p *python.Peer) { p.Node.Key = "abcd" }, PEER_INVALID_NODE},
+		{"loopback", func(p *python.Peer) { p.Address = "127.0.0.1" }, PEER_RESERVED_ADDRESS},
+		{"private", func(p *python.Peer) { p.Address = "192.168.1.1" }, PEER_RESERVED_ADDRESS},
+		{"shared", func(p *python.Peer) { p.Address = "100.64.0.1" }, PEER_RESERVED_ADDRESS},
+		{"unique local", func(p *python.Peer) { p.Address = "fd00::1" }, PEER_RESERVED_ADDRESS},
+		{"link local", func(p *python.Peer) { p.Address = "fe80::1" }, PEER_RESERVED_ADDRESS},
+	}
+	for _, c := range cases {
+		p := valid()
+		c.modify(&p)
+		_, decision := service.sanitizePeer(p)
+		assert.False(t, decision.Stored, c.name)
+		assert.Equal(t, c.reason, decision.Reason, c.name)
+		assert.NotEmpty(t, decision.Detail, c.name)
+	}
+}
+
+func TestSanitizePeerPubAddr(t *testing.T) {
+	service := getService(t, getConfig(), NewTestPeerKeeper())
+	node := &python.Node{Key: TEST_NODE_KEY, PubAddr: "198.51.100.1"}
+	peer, decision := service.sanitizePeer(python.Peer{Address: "203.0.113.7", Port: 40102, Node: node})
+	assert.True(t, decision.Stored)
+	assert.Equal(t, PEER_PUB_ADDR_REPLACED, decision.Reason)
+	assert.Equal(t, "203.0.113.7", peer.Node.PubAddr)
+	// the session's record is left intact
+	assert.Equal(t, "198.51.100.1", node.PubAddr)
+
+	peer, decision = service.sanitizePeer(python.Peer{Address: "203.0.113.7", Port: 40102, Node: &python.Node{Key: TEST_NODE_KEY}})
+	assert.Equal(t, PEER_STORED, decision.Reason)
+	assert.Equal(t, "203.0.113.7", peer.Node.PubAddr)
+
+	peer, decision = service.sanitizePeer(python.Peer{Address: "2001:db8::1", Port: 40102, Node: &python.Node{Key: TEST_NODE_KEY, PubAddr: "2001:db8:0::1"}})
+	assert.Equal(t, PEER_STORED, decision.Reason)
+	assert.Equal(t, "2001:db8:0::1", peer.Node.PubAddr)
+
+	config := getConfig()
+	config.AllowReservedAddresses = true
+	service = getService(t, config, NewTestPeerKeeper())
+	peer, decision = service.sanitizePeer(python.Peer{Address: "10.0.0.7", Port: 40102, Node: &python.Node{Key: TEST_NODE_KEY, PubAddr: "203.0.113.7"}})
+	assert.True(t, decision.Stored)
+	assert.Equal(t, "10.0.0.7", peer.Node.PubAddr)
+}
+
+func TestPeerDecisionRecorded(t *testing.T) {
+	pk := NewTestPeerKeeper()
+	service := getService(t, getConfig(), pk)
+	decisions := make(chan PeerDecision, 1)
+	service.Use(Hooks{
+		OnPeerDecision: func(session *PeerSession, decision PeerDecision) {
+			assert.Equal(t, decision, session.PeerDecision())
+			decisions <- decision
+		},
+	})
+	handleCh := make(chan error, 1)
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 40102}
+	client := startNetworkSession(t, service, service.networks[0], addr, handleCh)
+	client.handshake("loopback-client")
+	client.receive()
+	disconnect := client.receive().(*message.Disconnect)
+	assert.Equal(t, message.DISCONNECT_BOOTSTRAP, disconnect.Reason)
+	require.NoError(t, <-handleCh)
+
+	decision := <-decisions
+	assert.False(t, decision.Stored)
+	assert.Equal(t, PEER_RESERVED_ADDRESS, decision.Reason)
+	assert.Empty(t, pk.AddPeerCalls)
+}
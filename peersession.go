@@ -4,42 +4,106 @@ import (
 	"encoding/hex"
 	"fmt"
 	"net"
+	"sort"
+	"time"
 
 	"github.com/golemfactory/bootstrap_go/crypto"
+	"github.com/golemfactory/bootstrap_go/logging"
 	"github.com/golemfactory/bootstrap_go/message"
 	"github.com/golemfactory/bootstrap_go/python"
-	"golang.org/x/crypto/sha3"
+	"github.com/golemfactory/bootstrap_go/random"
+	"github.com/golemfactory/bootstrap_go/semver"
 )
 
 type PeerSession struct {
 	service *Service
+	network *Network
 	conn    net.Conn
+	reader  *message.FrameReader
+	writer  *message.FrameWriter
 	pubKey  crypto.PublicKey
 	inited  bool
 	peer    python.Peer
 	id      string
+	// disconnectReason of the Disconnect message sent or received.
+	disconnectReason message.DisconnectReason
+	peerDecision     PeerDecision
+	// baseLog carries the fields fixed for the session, log additionally
+	// carries the current phase.
+	baseLog logging.Logger
+	log     logging.Logger
 }
 
+// NewPeerSession creates a session in the primary network of the service.
 func NewPeerSession(service *Service, conn net.Conn) *PeerSession {
+	return newPeerSession(service, service.networks[0], conn)
+}
+
+func newPeerSession(service *Service, network *Network, conn net.Conn) *PeerSession {
+	baseLog := service.log.With(
+		"remote_addr", conn.RemoteAddr().String(),
+		"session_id", service.nextSessionId(),
+		"network", network.ProtocolId)
 	return &PeerSession{
 		service: service,
+		network: network,
 		conn:    conn,
+		reader:  message.NewFrameReader(conn),
+		writer:  message.NewFrameWriter(conn),
+		baseLog: baseLog,
+		log:     baseLog.With("phase", "connected"),
 	}
 }
 
+func (session *PeerSession) setPhase(phase string) {
+	session.log = session.baseLog.With("phase", phase)
+}
+
 func (session *PeerSession) Close() {
 	session.conn.Close()
 }
 
+// Id returns the client key id of the verified peer.
+func (session *PeerSession) Id() string {
+	return session.id
+}
+
+// Peer returns the record of the verified peer.
+func (session *PeerSession) Peer() python.Peer {
+	return session.peer
+}
+
+// PeerDecision returns the outcome of storing the peer, zero until
+// the handshake is complete.
+func (session *PeerSession) PeerDecision() PeerDecision {
+	return session.peerDecision
+}
+
+func (session *PeerSession) RemoteAddr() net.Addr {
+	return session.conn.RemoteAddr()
+}
+
+func (session *PeerSession) Send(msg message.Message) error {
+	return session.sendMessage(msg)
+}
+
+// Disconnect sends the Disconnect message, the session ends after the
+// current handler returns.
+func (session *PeerSession) Disconnect(reason message.DisconnectReason) error {
+	return session.sendDisconnect(reason)
+}
+
 func (session *PeerSession) sendDisconnect(reason message.DisconnectReason) error {
+	session.disconnectReason = reason
 	return session.sendMessage(&message.Disconnect{Reason: reason})
 }
 
 func (session *PeerSession) performHandshake() error {
 	conn := session.conn
 	service := session.service
+	session.setPhase("handshake")
 
-	myHello := service.genHello()
+	myHello := service.genHello(session.network)
 	err := session.sendMessage(myHello)
 	if err != nil {
 		return fmt.Errorf("send hello error: %v", err)
@@ -49,6 +113,7 @@ func (session *PeerSession) performHandshake() error {
 		return fmt.Errorf("receive hello error: %v", err)
 	}
 	if disconnectMsg, ok := msg.(*message.Disconnect); ok {
+		session.disconnectReason = disconnectMsg.Reason
 		return fmt.Errorf("peer disconnected, reason: %v", disconnectMsg.Reason)
 	}
 
@@ -57,11 +122,26 @@ func (session *PeerSession) performHandshake() error {
 		return fmt.Errorf("was expecting Hello, got type %d", msg.GetType())
 	}
 
-	if helloMsg.ProtoId != session.service.config.ProtocolId {
+	if helloMsg.ProtoId != session.network.ProtocolId {
 		if err := session.sendDisconnect(message.DISCONNECT_PROTOCOL_VERSION); err != nil {
 			return err
 		}
-		return fmt.Errorf("not matching protocol ID, remote %v, local %v", helloMsg.ProtoId, session.service.config.ProtocolId)
+		return fmt.Errorf("not matching protocol ID, remote %v, local %v", helloMsg.ProtoId, session.network.ProtocolId)
+	}
+
+	// golem-messages has no separate reason for the golem and
+	// golem-messages versions
+	if helloMsg.TrailerVersion != helloMsg.GolemMessagesVersion {
+		if err := session.sendDisconnect(message.DISCONNECT_PROTOCOL_VERSION); err != nil {
+			return err
+		}
+		return fmt.Errorf("Hello trailer version %q doesn't match declared version %q", helloMsg.TrailerVersion, helloMsg.GolemMessagesVersion)
+	}
+	if err := session.checkVersions(helloMsg); err != nil {
+		if err := session.sendDisconnect(message.DISCONNECT_PROTOCOL_VERSION); err != nil {
+			return err
+		}
+		return err
 	}
 
 	nodeInfo, err := python.DictToNode(helloMsg.NodeInfo)
@@ -79,11 +159,27 @@ func (session *PeerSession) performHandshake() error {
 	}
 	session.inited = true
 
+	// the Hello is checked only now that its key is known, before it
+	// gets into the replay cache
+	if !session.verifySign(helloMsg.ShortHash(), helloMsg.GetSignature()) {
+		session.recordSignatureFailure()
+		if err := session.sendDisconnect(message.DISCONNECT_UNVERIFIED); err != nil {
+			return err
+		}
+		return fmt.Errorf("receive hello error: %v", message.ErrIncorrectSignature)
+	}
+	if err := session.checkReplay(helloMsg); err != nil {
+		return err
+	}
+	session.baseLog = session.baseLog.With("peer_key", nodeInfo.Key)
+	session.setPhase("handshake")
+
 	msg, err = session.receiveMessage()
 	if err != nil {
 		return fmt.Errorf("receive randval error: %v", err)
 	}
 	if disconnectMsg, ok := msg.(*message.Disconnect); ok {
+		session.disconnectReason = disconnectMsg.Reason
 		return fmt.Errorf("peer disconnected, reason: %v", disconnectMsg.Reason)
 	}
 
@@ -91,6 +187,9 @@ func (session *PeerSession) performHandshake() error {
 	if !ok {
 		return fmt.Errorf("expected RandVal message, got type %d", msg.GetType())
 	}
+	if err := session.checkReplay(randValMsg); err != nil {
+		return err
+	}
 	if randValMsg.RandVal != myHello.RandVal {
 		return fmt.Errorf("incorrect RandVal value")
 	}
@@ -101,7 +200,7 @@ func (session *PeerSession) performHandshake() error {
 		return err
 	}
 
-	addr, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	addr, err := peerAddress(conn.RemoteAddr())
 	if err != nil {
 		return err
 	}
@@ -111,50 +210,245 @@ func (session *PeerSession) performHandshake() error {
 		Port:     helloMsg.Port,
 		Node:     nodeInfo,
 		NodeName: helloMsg.NodeName,
+
+		ClientVer:            helloMsg.ClientVer,
+		GolemMessagesVersion: helloMsg.GolemMessagesVersion,
+	}
+	session.peer.Record = python.NewHelloRecord(helloMsg)
+	if _, err := session.peer.VerifyRecord(); err != nil {
+		// e.g. a Hello not encoded the way it was signed
+		session.log.Debug("dropping unverifiable peer record", "err", err)
+		session.peer.Record = nil
 	}
 	session.id = helloMsg.ClientKeyId
 	return nil
 }
 
 func (session *PeerSession) handle() error {
-	err := session.performHandshake()
+	handshakeTimeout := session.service.config.HandshakeTimeout
+	if handshakeTimeout == 0 {
+		handshakeTimeout = DEFAULT_HANDSHAKE_TIMEOUT
+	}
+	// bounds the whole bootstrap session, so slow clients can't hold it
+	err := session.conn.SetDeadline(time.Now().Add(handshakeTimeout))
 	if err != nil {
 		return err
 	}
+	err = session.performHandshake()
+	if err != nil {
+		return err
+	}
+	if rule, banned := session.service.checkKeyBanned(session.peer.Node.Key); banned {
+		// golem-messages has no reason for bans, the peer is just turned
+		// away like after a regular bootstrap session
+		if err := session.sendDisconnect(message.DISCONNECT_BOOTSTRAP); err != nil {
+			return err
+		}
+		return fmt.Errorf("banned node key, reason: %v", rule.Reason)
+	}
+
+	session.service.onHandshakeComplete(session)
+
+	session.setPhase("peers")
+	err = session.SendPeers()
+	if err != nil {
+		return err
+	}
+	session.peerDecision = session.service.addPeer(session.network, session.id, session.peer)
+	if session.peerDecision.Stored {
+		session.log.Debug("stored peer", "reason", session.peerDecision.Reason, "detail", session.peerDecision.Detail)
+	} else {
+		session.log.Info("not storing peer", "reason", session.peerDecision.Reason, "detail", session.peerDecision.Detail)
+	}
+	session.service.onPeerDecision(session, session.peerDecision)
+
+	if session.service.config.SessionMode == SESSION_MODE_LONG_LIVED {
+		session.setPhase("session")
+		if err := session.conn.SetDeadline(time.Time{}); err != nil {
+			return err
+		}
+		return session.loop()
+	}
+
+	session.setPhase("disconnect")
+	return session.sendDisconnect(message.DISCONNECT_BOOTSTRAP)
+}
 
-	pk := session.service.peerKeeper
-	peers := pk.GetPeers(session.id)
+func (session *PeerSession) checkVersions(hello *message.Hello) error {
+	network := session.network
+	checks := []struct {
+		name     string
+		version  string
+		accepted []semver.Range
+	}{
+		{"golem-messages", hello.GolemMessagesVersion, network.AcceptedGolemMessagesVersions},
+		{"golem", hello.ClientVer, network.AcceptedGolemVersions},
+	}
+	for _, c := range checks {
+		if len(c.accepted) == 0 {
+			continue
+		}
+		v, err := semver.Parse(c.version)
+		if err != nil {
+			return fmt.Errorf("malformed %s version: %v", c.name, err)
+		}
+		if !semver.Satisfies(v, c.accepted) {
+			return fmt.Errorf("incompatible %s version %v, accepted %v", c.name, v, c.accepted)
+		}
+	}
+	return nil
+}
+
+// SendPeers sends a fresh random sample of known peers of the session's
+// network reachable with the peer's address families, the ones compatible
+// with the peer's golem-messages version first.
+func (session *PeerSession) SendPeers() error {
+	// keepers may return the peers in a fixed order and share the slice
+	peers := append([]python.Peer(nil), session.network.PeerKeeper.GetPeers(session.id)...)
+	random.Shuffle(session.service.rand, len(peers), func(i, j int) {
+		peers[i], peers[j] = peers[j], peers[i]
+	})
+	peers = reachablePeers(peers, &session.peer)
+	preferCompatiblePeers(peers, session.peer.GolemMessagesVersion)
+	if n := session.network.PeerNum; n > 0 && len(peers) > n {
+		peers = peers[:n]
+	}
 	peersMsg := &message.Peers{
 		Peers: make([]interface{}, len(peers)),
 	}
 	for idx, p := range peers {
+		if !session.service.config.SendPeerRecords {
+			p.Record = nil
+		}
 		peersMsg.Peers[idx] = p.ToDict()
 	}
-	err = session.sendMessage(peersMsg)
+	err := session.sendMessage(peersMsg)
 	if err != nil {
 		return err
 	}
-	pk.AddPeer(session.id, session.peer)
+	session.log.Debug("sent peers", "count", len(peers))
+	return nil
+}
 
-	disconnectMsg := &message.Disconnect{
-		Reason: message.DISCONNECT_BOOTSTRAP,
-	}
-	err = session.sendMessage(disconnectMsg)
+func preferCompatiblePeers(peers []python.Peer, golemMessagesVersion string) {
+	v, err := semver.Parse(golemMessagesVersion)
 	if err != nil {
-		return err
+		return
+	}
+	compatible := func(p *python.Peer) bool {
+		pv, err := semver.Parse(p.GolemMessagesVersion)
+		return err == nil && pv.Compatible(v)
 	}
+	sort.SliceStable(peers, func(i, j int) bool {
+		return compatible(&peers[i]) && !compatible(&peers[j])
+	})
+}
 
+// loop answers the peer's requests until it disconnects or stays idle
+// for longer than the configured timeout.
+func (session *PeerSession) loop() error {
+	idleTimeout := session.service.config.IdleTimeout
+	if idleTimeout == 0 {
+		idleTimeout = DEFAULT_IDLE_TIMEOUT
+	}
+	writeTimeout := session.service.config.WriteTimeout
+	if writeTimeout == 0 {
+		writeTimeout = DEFAULT_WRITE_TIMEOUT
+	}
+	for {
+		err := session.conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		if err != nil {
+			return err
+		}
+		msg, readErr := session.receiveMessage()
+		err = session.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if err != nil {
+			return err
+		}
+		err = readErr
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			session.log.Debug("peer idle for too long", "timeout", idleTimeout)
+			return session.sendDisconnect(message.DISCONNECT_TIMEOUT)
+		}
+		if err != nil {
+			return err
+		}
+
+		if disconnectMsg, ok := msg.(*message.Disconnect); ok {
+			session.disconnectReason = disconnectMsg.Reason
+			session.log.Debug("peer disconnected", "reason", disconnectMsg.Reason)
+			return nil
+		}
+		handler, ok := session.service.handlers[msg.GetType()]
+		if !ok {
+			session.log.Debug("ignoring message", "msg_type", msg.GetType())
+			continue
+		}
+		if err := handler(session, msg); err != nil {
+			return err
+		}
+		if session.disconnectReason != "" {
+			return nil
+		}
+	}
+}
+
+// checkReplay rejects handshake messages already seen. They are told
+// apart by the hash their signature is made over rather than by the
+// signature, which is easily altered. Only verified messages may be
+// checked, so forged ones can't fill the cache.
+func (session *PeerSession) checkReplay(msg message.Message) error {
+	cache := session.service.replayCache
+	hashed, ok := msg.(interface {
+		ShortHash() []byte
+	})
+	if cache != nil && ok && cache.Seen(hashed.ShortHash()) {
+		return fmt.Errorf("replayed message of type %d", msg.GetType())
+	}
 	return nil
 }
 
 func (session *PeerSession) receiveMessage() (message.Message, error) {
-	return message.Receive(session.conn, session.decrypt, session.verifySign)
+	config := session.service.config
+	msg, err := session.reader.ReadMessage(
+		session.decrypt,
+		session.verifySign,
+		&message.Options{
+			Logger:       session.log,
+			MaxClockSkew: config.MaxClockSkew,
+			Clock:        session.service.clock,
+		})
+	if err == message.ErrIncorrectSignature {
+		session.recordSignatureFailure()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := session.service.onMessage(session, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (session *PeerSession) recordSignatureFailure() {
+	bans := session.service.config.Bans
+	ip := addrIP(session.conn.RemoteAddr())
+	if bans == nil || ip == nil {
+		return
+	}
+	banned, err := bans.RecordSignatureFailure(ip)
+	if err != nil {
+		session.log.Error("couldn't persist automatic ban", "ip", ip.String(), "err", err)
+	}
+	if banned {
+		session.log.Warn("banned peer after repeated signature failures", "ip", ip.String())
+	}
 }
 
 func (session *PeerSession) sendMessage(msg message.Message) error {
-	return message.Send(
-		session.conn,
+	return session.writer.WriteMessage(
 		msg,
+		session.service.clock.Now(),
 		session.encrypt,
 		session.sign)
 }
@@ -175,19 +469,13 @@ func (session *PeerSession) encrypt(data []byte) ([]byte, error) {
 	return res, nil
 }
 
-func GetShortHashSha(data []byte) []byte {
-	sha := sha3.New256()
-	sha.Write(data)
-	return sha.Sum(nil)
-}
-
 func (session *PeerSession) sign(shortHash []byte) ([]byte, error) {
-	return session.service.privKey.Sign(GetShortHashSha(shortHash))
+	return session.service.privKey.Sign(message.ShortHashSha(shortHash))
 }
 
 func (session *PeerSession) verifySign(shortHash []byte, sig []byte) bool {
 	if !session.inited {
 		return true
 	}
-	return session.pubKey.VerifySign(GetShortHashSha(shortHash), sig)
+	return session.pubKey.VerifySign(message.ShortHashSha(shortHash), sig)
 }
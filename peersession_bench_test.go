@@ -0,0 +1,42 @@
+package bootstrap_test
+
+import (
+	"testing"
+
+	"github.com/golemfactory/bootstrap_go/bootstraptest"
+)
+
+// BenchmarkPeerSessionHandle measures a full bootstrap session: the
+// handshake with its ECIES and secp256k1 operations on both sides, Peers
+// and Disconnect.
+func BenchmarkPeerSessionHandle(b *testing.B) {
+	h := bootstraptest.New(b, bootstraptest.Options{Bootstraps: 1, Clients: 10, PeerNum: 10})
+	defer h.Close()
+	h.Connect(h.Bootstraps[0], h.Clients...)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		res := h.Clients[i%len(h.Clients)].Bootstrap(h.Bootstraps[0], bootstraptest.Link{})
+		if res.Err != nil {
+			b.Fatal(res.Err)
+		}
+	}
+}
+
+func BenchmarkPeerSessionHandleParallel(b *testing.B) {
+	h := bootstraptest.New(b, bootstraptest.Options{Bootstraps: 1, Clients: 10, PeerNum: 10})
+	defer h.Close()
+	h.Connect(h.Bootstraps[0], h.Clients...)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			res := h.Clients[i%len(h.Clients)].Bootstrap(h.Bootstraps[0], bootstraptest.Link{})
+			if res.Err != nil {
+				b.Fatal(res.Err)
+			}
+			i++
+		}
+	})
+}
@@ -1,15 +1,22 @@
 package bootstrap
 
 import (
+	"encoding/binary"
 	"encoding/hex"
+	"fmt"
 	"net"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/golemfactory/bootstrap_go/ban"
+	"github.com/golemfactory/bootstrap_go/clock"
 	"github.com/golemfactory/bootstrap_go/crypto"
 	"github.com/golemfactory/bootstrap_go/message"
 	"github.com/golemfactory/bootstrap_go/peerkeeper"
 	"github.com/golemfactory/bootstrap_go/python"
+	"github.com/golemfactory/bootstrap_go/random"
+	"github.com/golemfactory/bootstrap_go/semver"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -17,6 +24,7 @@ import (
 const (
 	TEST_NAME     = "bootstrap-unittest"
 	TEST_PROTO_ID = "1337"
+	TEST_PORT     = 44444
 )
 
 type TestAddress struct {
@@ -32,9 +40,14 @@ func (a *TestAddress) String() string {
 
 type TestConn struct {
 	net.Conn
+	// Addr defaults to TestAddress.
+	Addr net.Addr
 }
 
 func (c *TestConn) RemoteAddr() net.Addr {
+	if c.Addr != nil {
+		return c.Addr
+	}
 	return &TestAddress{}
 }
 
@@ -68,121 +81,184 @@ func (pk *TestPeerKeeper) GetPeers(id string) []python.Peer {
 	return nil
 }
 
-func getService(t *testing.T, pk peerkeeper.PeerKeeper) *Service {
-	privKey, err := crypto.GeneratePrivateKey()
-	if err != nil {
-		t.Fatal("Error while generating private key", err)
-	}
-
-	config := &Config{
+func getConfig() *Config {
+	return &Config{
 		Name:         TEST_NAME,
 		Id:           "deadbeef",
-		Port:         44444,
-		PrvAddr:      "prvAddr",
-		PubAddr:      "pubAddr",
-		PrvAddresses: nil,
-		NatType:      make([]interface{}, 0),
+		Port:         TEST_PORT,
+		PrvAddr:      "10.0.0.1",
+		PubAddr:      "203.0.113.1",
+		PrvAddresses: []string{"10.0.0.1"},
+		NatType:      []python.NatType{python.NAT_FULL_CONE},
 		PeerNum:      100,
 		ProtocolId:   TEST_PROTO_ID,
 	}
+}
 
+func getService(t *testing.T, config *Config, pk peerkeeper.PeerKeeper) *Service {
+	privKey, err := crypto.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal("Error while generating private key", err)
+	}
 	return NewService(config, privKey, pk)
 }
 
-func testPeerSessionImpl(t *testing.T, handleCh chan error) {
-	const (
-		RAND_VAL  = 0.1337
-		CLIENT_ID = "client-id"
-	)
+// testClient plays the Golem node's side of a session.
+type testClient struct {
+	t           *testing.T
+	conn        net.Conn
+	service     *Service
+	privKey     crypto.PrivateKey
+	otherPubKey crypto.PublicKey
+	inited      bool
+	protoId     string
+}
+
+func startSession(t *testing.T, service *Service, handleCh chan error) *testClient {
+	return startNetworkSession(t, service, service.networks[0], nil, handleCh)
+}
+
+// startNetworkSession starts a session in the given network, addr is
+// the client's address as seen by the service, TestAddress when nil.
+func startNetworkSession(t *testing.T, service *Service, n *Network, addr net.Addr, handleCh chan error) *testClient {
 	privKey, err := crypto.GeneratePrivateKey()
 	require.NoError(t, err)
-	pubKey := privKey.GetPublicKey()
-	pubKeyHex := pubKey.Hex()
-
-	pk := &TestPeerKeeper{}
-	service := getService(t, pk)
 	conn, psConn := net.Pipe()
-	ps := NewPeerSession(service, &TestConn{Conn: psConn})
 	go func() {
-		handleCh <- ps.handle()
+		handleCh <- service.serveConn(&TestConn{Conn: psConn, Addr: addr}, n)
 	}()
+	return &testClient{
+		t:       t,
+		conn:    conn,
+		service: service,
+		privKey: privKey,
+		protoId: n.ProtocolId,
+	}
+}
 
-	var otherPubKey crypto.PublicKey
-	inited := false
+func (c *testClient) send(msg message.Message) {
 	signFunc := func(shortHash []byte) ([]byte, error) {
-		return privKey.Sign(GetShortHashSha(shortHash))
+		return c.privKey.Sign(message.ShortHashSha(shortHash))
+	}
+	encryptFunc := func(data []byte) ([]byte, error) {
+		return crypto.Encrypt(data, c.service.privKey.GetPublicKey())
 	}
+	err := message.Send(c.conn, msg, encryptFunc, signFunc)
+	require.NoError(c.t, err)
+}
+
+func (c *testClient) receive() message.Message {
 	verifySignFunc := func(shortHash []byte, sig []byte) bool {
-		if !inited {
+		if !c.inited {
 			return true
 		}
-		return otherPubKey.VerifySign(GetShortHashSha(shortHash), sig)
-	}
-	encryptFunc := func(data []byte) ([]byte, error) {
-		return crypto.Encrypt(data, service.privKey.GetPublicKey())
+		return c.otherPubKey.VerifySign(message.ShortHashSha(shortHash), sig)
 	}
 	decryptFunc := func(data []byte) ([]byte, error) {
-		return privKey.Decrypt(data)
+		return c.privKey.Decrypt(data)
 	}
+	msg, err := message.Receive(c.conn, decryptFunc, verifySignFunc, nil)
+	require.NoError(c.t, err)
+	return msg
+}
 
-	msg, err := message.Receive(conn, nil, verifySignFunc)
-	require.NoError(t, err)
-	serverHello := msg.(*message.Hello)
+// hello receives the server's Hello and answers with the given one.
+func (c *testClient) hello(hello *message.Hello) *message.Hello {
+	t := c.t
+	pubKey := c.privKey.GetPublicKey()
+
+	serverHello := c.receive().(*message.Hello)
 	assert.Equal(t, TEST_NAME, serverHello.NodeName)
 
 	nodeInfo, err := python.DictToNode(serverHello.NodeInfo)
 	require.NoError(t, err)
 	pubKeyBytes, err := hex.DecodeString(nodeInfo.Key)
 	require.NoError(t, err)
-	otherPubKey, err = crypto.PublicKeyFromBytes(append([]byte{0x04}, pubKeyBytes...))
+	c.otherPubKey, err = crypto.PublicKeyFromBytes(append([]byte{0x04}, pubKeyBytes...))
 	require.NoError(t, err)
-	inited = true
+	c.inited = true
 
 	node := python.Node{
-		Key: pubKeyHex,
-	}
-	hello := &message.Hello{
-		RandVal:     RAND_VAL,
-		ClientKeyId: CLIENT_ID,
-		NodeInfo:    node.ToDict(),
-		ProtoId:     TEST_PROTO_ID,
+		Key: pubKey.Hex(),
 	}
-	err = message.Send(conn, hello, encryptFunc, signFunc)
-	require.NoError(t, err)
+	hello.NodeInfo = node.ToDict()
+	hello.ProtoId = c.protoId
+	c.send(hello)
+	return serverHello
+}
 
-	randVal := &message.RandVal{
+func (c *testClient) handshake(clientId string) {
+	const RAND_VAL = 0.1337
+	serverHello := c.hello(&message.Hello{
+		Port:        TEST_PORT,
+		RandVal:     RAND_VAL,
+		ClientKeyId: clientId,
+	})
+	c.send(&message.RandVal{
 		RandVal: serverHello.RandVal,
-	}
-	err = message.Send(conn, randVal, encryptFunc, signFunc)
-	require.NoError(t, err)
+	})
 
-	msg, err = message.Receive(conn, decryptFunc, verifySignFunc)
-	require.NoError(t, err)
-	serverRandVal, ok := msg.(*message.RandVal)
-	require.True(t, ok)
-	assert.Equal(t, RAND_VAL, serverRandVal.RandVal)
+	serverRandVal, ok := c.receive().(*message.RandVal)
+	require.True(c.t, ok)
+	assert.Equal(c.t, RAND_VAL, serverRandVal.RandVal)
+}
 
-	msg, err = message.Receive(conn, decryptFunc, verifySignFunc)
-	require.NoError(t, err)
-	serverPeers := msg.(*message.Peers)
+func testPeerSessionImpl(t *testing.T, handleCh chan error) {
+	const CLIENT_ID = "client-id"
+
+	pk := &TestPeerKeeper{}
+	client := startSession(t, getService(t, getConfig(), pk), handleCh)
+	client.handshake(CLIENT_ID)
+
+	serverPeers := client.receive().(*message.Peers)
 	assert.Equal(t, 0, len(serverPeers.Peers))
 
-	msg, err = message.Receive(conn, decryptFunc, verifySignFunc)
-	require.NoError(t, err)
-	disconnect := msg.(*message.Disconnect)
+	disconnect := client.receive().(*message.Disconnect)
 	assert.Equal(t, message.DISCONNECT_BOOTSTRAP, disconnect.Reason)
 
 	require.Equal(t, 1, len(pk.GetPeersCalls))
 	assert.Equal(t, CLIENT_ID, pk.GetPeersCalls[0].Id)
 	require.Equal(t, 1, len(pk.AddPeerCalls))
 	assert.Equal(t, CLIENT_ID, pk.AddPeerCalls[0].Id)
+	stored := pk.AddPeerCalls[0].Peer
+	require.NotNil(t, stored.Record)
+	_, err := stored.VerifyRecord()
+	assert.NoError(t, err)
 }
 
-func TestPeerSession(t *testing.T) {
+// A malformed key must be rejected before it's used as a public key.
+func TestShortNodeKey(t *testing.T) {
+	handleCh := make(chan error, 1)
+	client := startSession(t, getService(t, getConfig(), NewTestPeerKeeper()), handleCh)
+	client.receive()
+	node := python.Node{Key: "abcd"}
+	client.send(&message.Hello{
+		ProtoId:  client.protoId,
+		Port:     TEST_PORT,
+		NodeInfo: node.ToDict(),
+	})
+	assert.Error(t, <-handleCh)
+}
+
+func TestBannedNodeKey(t *testing.T) {
+	config := getConfig()
+	config.Bans = ban.NewList()
+	handleCh := make(chan error, 1)
+	client := startSession(t, getService(t, config, NewTestPeerKeeper()), handleCh)
+	pubKey := client.privKey.GetPublicKey()
+	require.NoError(t, config.Bans.Add(ban.Rule{Type: ban.RULE_KEY, Value: pubKey.Hex()}))
+
+	client.handshake("banned")
+	disconnect := client.receive().(*message.Disconnect)
+	assert.Equal(t, message.DISCONNECT_BOOTSTRAP, disconnect.Reason)
+	assert.Contains(t, (<-handleCh).Error(), "banned node key")
+}
+
+func runSessionTest(t *testing.T, impl func(*testing.T, chan error)) {
 	testCh := make(chan bool)
 	handleCh := make(chan error)
 	go func() {
-		testPeerSessionImpl(t, handleCh)
+		impl(t, handleCh)
 		close(testCh)
 	}()
 
@@ -194,3 +270,339 @@ func TestPeerSession(t *testing.T) {
 		t.Fatal("Test timed out")
 	}
 }
+
+func TestPeerSession(t *testing.T) {
+	runSessionTest(t, testPeerSessionImpl)
+}
+
+func TestPeerRecords(t *testing.T) {
+	handleCh := make(chan error)
+	pk := peerkeeper.NewRandomizedPeerKeeper(10)
+	config := getConfig()
+	service := getService(t, config, pk)
+	addr := &net.TCPAddr{IP: net.ParseIP("198.18.0.1"), Port: 40102}
+	first := startNetworkSession(t, service, service.networks[0], addr, handleCh)
+	first.handshake("first")
+	first.receive()
+	first.receive()
+	require.NoError(t, <-handleCh)
+
+	for _, sendRecords := range []bool{false, true} {
+		config.SendPeerRecords = sendRecords
+		client := startSession(t, service, handleCh)
+		client.handshake("client")
+		serverPeers := client.receive().(*message.Peers)
+		require.Equal(t, 1, len(serverPeers.Peers))
+		dict, err := message.DecodeMap(serverPeers.Peers[0])
+		require.NoError(t, err)
+		peer, err := python.DictToPeer(dict)
+		require.NoError(t, err)
+		if !sendRecords {
+			assert.Nil(t, peer.Record)
+		} else if assert.NotNil(t, peer.Record) {
+			node, err := peer.VerifyRecord()
+			require.NoError(t, err)
+			pubKey := first.privKey.GetPublicKey()
+			assert.Equal(t, pubKey.Hex(), node.Key)
+		}
+		client.receive()
+		require.NoError(t, <-handleCh)
+	}
+}
+
+func testLongLivedPeerSessionImpl(t *testing.T, handleCh chan error) {
+	const CLIENT_ID = "client-id"
+
+	pk := peerkeeper.NewRandomizedPeerKeeper(10)
+	pk.AddPeer("other", python.Peer{NodeName: "other", Node: &python.Node{}})
+	config := getConfig()
+	config.SessionMode = SESSION_MODE_LONG_LIVED
+	config.IdleTimeout = 100 * time.Millisecond
+	client := startSession(t, getService(t, config, pk), handleCh)
+	client.handshake(CLIENT_ID)
+
+	serverPeers := client.receive().(*message.Peers)
+	assert.Equal(t, 1, len(serverPeers.Peers))
+
+	client.send(&message.Ping{})
+	_, ok := client.receive().(*message.Pong)
+	assert.True(t, ok)
+
+	client.send(&message.GetPeers{})
+	serverPeers = client.receive().(*message.Peers)
+	assert.Equal(t, 1, len(serverPeers.Peers))
+
+	disconnect := client.receive().(*message.Disconnect)
+	assert.Equal(t, message.DISCONNECT_TIMEOUT, disconnect.Reason)
+	assert.NoError(t, <-handleCh)
+}
+
+func TestLongLivedPeerSession(t *testing.T) {
+	// the session lasts for several round trips, more than runSessionTest
+	// allows with the race detector
+	testLongLivedPeerSessionImpl(t, make(chan error, 1))
+}
+
+// fixedPeerKeeper always returns its peers in the same order.
+type fixedPeerKeeper []python.Peer
+
+func (pk fixedPeerKeeper) AddPeer(string, python.Peer) {}
+
+func (pk fixedPeerKeeper) GetPeers(string) []python.Peer {
+	return pk
+}
+
+func TestGetPeersSample(t *testing.T) {
+	pk := make(fixedPeerKeeper, 5)
+	for i := range pk {
+		name := fmt.Sprintf("peer%d", i)
+		pk[i] = python.Peer{NodeName: name, Node: &python.Node{}}
+	}
+	config := getConfig()
+	config.SessionMode = SESSION_MODE_LONG_LIVED
+	config.PeerNum = 1
+	config.Rand = random.NewSeeded(1)
+	handleCh := make(chan error, 1)
+	client := startSession(t, getService(t, config, pk), handleCh)
+	client.handshake("client-id")
+	client.receive()
+
+	names := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		client.send(&message.GetPeers{})
+		serverPeers := client.receive().(*message.Peers)
+		require.Equal(t, 1, len(serverPeers.Peers))
+		dict, err := message.DecodeMap(serverPeers.Peers[0])
+		require.NoError(t, err)
+		names[dict["node_name"].(string)] = true
+	}
+	assert.Equal(t, 5, len(names))
+	assert.Equal(t, "peer0", pk[0].NodeName, "the keeper's peers are left intact")
+	client.conn.Close()
+	<-handleCh
+}
+
+// A client not reading the responses can't hold the session.
+func TestLongLivedWriteTimeout(t *testing.T) {
+	config := getConfig()
+	config.SessionMode = SESSION_MODE_LONG_LIVED
+	config.WriteTimeout = 100 * time.Millisecond
+	handleCh := make(chan error, 1)
+	client := startSession(t, getService(t, config, NewTestPeerKeeper()), handleCh)
+	client.handshake("client-id")
+	client.receive()
+
+	client.send(&message.Ping{})
+	select {
+	case err := <-handleCh:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("session blocked writing to the client")
+	}
+}
+
+func TestReplayedHello(t *testing.T) {
+	config := getConfig()
+	config.MaxClockSkew = time.Minute
+	service := getService(t, config, NewTestPeerKeeper())
+
+	privKey, err := crypto.GeneratePrivateKey()
+	require.NoError(t, err)
+	pubKey := privKey.GetPublicKey()
+	node := python.Node{Key: pubKey.Hex()}
+	hello := &message.Hello{
+		RandVal:  0.1337,
+		NodeInfo: node.ToDict(),
+		ProtoId:  TEST_PROTO_ID,
+	}
+	frame, err := message.Serialize(hello, nil, func(shortHash []byte) ([]byte, error) {
+		return privKey.Sign(message.ShortHashSha(shortHash))
+	})
+	require.NoError(t, err)
+	lenBuf := make([]byte, 4)
+	binary.BigEndian.PutUint32(lenBuf, uint32(len(frame)))
+	// a copy with an altered signature mustn't get into the replay cache
+	forged := append([]byte(nil), frame...)
+	forged[message.HEADER_LEN] ^= 1
+
+	for i, f := range [][]byte{forged, frame, frame, forged} {
+		conn, psConn := net.Pipe()
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- service.serveConn(&TestConn{Conn: psConn}, service.networks[0])
+		}()
+		_, err := message.Receive(conn, nil, func([]byte, []byte) bool { return true }, nil)
+		require.NoError(t, err)
+		_, err = conn.Write(append(lenBuf, f...))
+		require.NoError(t, err)
+		switch i {
+		case 0, 3:
+			msg, err := message.Receive(conn, nil, func([]byte, []byte) bool { return true }, nil)
+			require.NoError(t, err)
+			assert.Equal(t, message.DISCONNECT_UNVERIFIED, msg.(*message.Disconnect).Reason)
+			assert.Contains(t, (<-errCh).Error(), message.ErrIncorrectSignature.Error())
+		case 1:
+			conn.Close()
+			assert.Contains(t, (<-errCh).Error(), "receive randval error")
+		case 2:
+			assert.Contains(t, (<-errCh).Error(), "replayed message")
+		}
+		conn.Close()
+	}
+}
+
+func TestIncompatibleVersion(t *testing.T) {
+	config := getConfig()
+	ranges, err := semver.ParseRanges("2.24.x-2.26.x")
+	require.NoError(t, err)
+	config.AcceptedGolemMessagesVersions = ranges
+	handleCh := make(chan error, 1)
+	client := startSession(t, getService(t, config, NewTestPeerKeeper()), handleCh)
+
+	client.hello(&message.Hello{GolemMessagesVersion: "2.27.0"})
+	disconnect := client.receive().(*message.Disconnect)
+	assert.Equal(t, message.DISCONNECT_PROTOCOL_VERSION, disconnect.Reason)
+	assert.Contains(t, (<-handleCh).Error(), "incompatible golem-messages version 2.27.0")
+}
+
+func TestTrailerVersionMismatch(t *testing.T) {
+	handleCh := make(chan error, 1)
+	client := startSession(t, getService(t, getConfig(), NewTestPeerKeeper()), handleCh)
+	client.receive()
+
+	pubKey := client.privKey.GetPublicKey()
+	node := python.Node{Key: pubKey.Hex()}
+	frame, err := message.Serialize(&message.Hello{
+		ProtoId:              client.protoId,
+		NodeInfo:             node.ToDict(),
+		GolemMessagesVersion: "2.24.3",
+	}, nil, func(shortHash []byte) ([]byte, error) {
+		return client.privKey.Sign(message.ShortHashSha(shortHash))
+	})
+	require.NoError(t, err)
+	// the trailer isn't signed
+	trailer := frame[len(frame)-message.HELLO_EXTRA_DATA_LEN:]
+	trailer[1+len("2.24.3")-1] = '4'
+	lenBuf := make([]byte, 4)
+	binary.BigEndian.PutUint32(lenBuf, uint32(len(frame)))
+	_, err = client.conn.Write(append(lenBuf, frame...))
+	require.NoError(t, err)
+
+	disconnect := client.receive().(*message.Disconnect)
+	assert.Equal(t, message.DISCONNECT_PROTOCOL_VERSION, disconnect.Reason)
+	assert.Contains(t, (<-handleCh).Error(), "trailer version")
+}
+
+func TestPreferCompatiblePeers(t *testing.T) {
+	peers := []python.Peer{
+		{NodeName: "old", GolemMessagesVersion: "2.23.0"},
+		{NodeName: "unknown"},
+		{NodeName: "compatible1", GolemMessagesVersion: "2.24.1"},
+		{NodeName: "compatible2", GolemMessagesVersion: "2.24.7"},
+	}
+	preferCompatiblePeers(peers, "2.24.3")
+	names := make([]string, len(peers))
+	for idx, p := range peers {
+		names[idx] = p.NodeName
+	}
+	assert.Equal(t, []string{"compatible1", "compatible2", "old", "unknown"}, names)
+}
+
+func TestMultipleNetworks(t *testing.T) {
+	mainnetPk := peerkeeper.NewRandomizedPeerKeeper(10)
+	service := getService(t, getConfig(), mainnetPk)
+	testnetPk := peerkeeper.NewRandomizedPeerKeeper(10)
+	err := service.AddNetwork(Network{
+		ProtocolId: TEST_PROTO_ID + "-testnet",
+		Port:       TEST_PORT + 1,
+		PeerKeeper: testnetPk,
+	})
+	require.NoError(t, err)
+	testnet := service.networks[1]
+
+	err = service.AddNetwork(Network{ProtocolId: TEST_PROTO_ID, Port: 1, PeerKeeper: testnetPk})
+	assert.Error(t, err)
+	err = service.AddNetwork(Network{ProtocolId: "other", Port: TEST_PORT, PeerKeeper: testnetPk})
+	assert.Error(t, err)
+	// it wouldn't fit in the Hello trailer
+	err = service.AddNetwork(Network{
+		ProtocolId:           "long",
+		Port:                 1,
+		PeerKeeper:           testnetPk,
+		GolemMessagesVersion: strings.Repeat("1", message.HELLO_MAX_VERSION_LEN+1),
+	})
+	assert.Error(t, err)
+
+	handleCh := make(chan error, 1)
+	client := startNetworkSession(t, service, testnet, nil, handleCh)
+	client.handshake("testnet-client")
+	assert.Equal(t, 0, len(client.receive().(*message.Peers).Peers))
+	client.receive()
+	require.NoError(t, <-handleCh)
+
+	client = startSession(t, service, handleCh)
+	client.handshake("mainnet-client")
+	assert.Equal(t, 0, len(client.receive().(*message.Peers).Peers))
+	client.receive()
+	require.NoError(t, <-handleCh)
+
+	assert.Equal(t, 1, len(mainnetPk.GetPeers("")))
+	assert.Equal(t, 1, len(testnetPk.GetPeers("")))
+
+	// a client of the wrong network is rejected
+	client = startNetworkSession(t, service, testnet, nil, handleCh)
+	client.protoId = TEST_PROTO_ID
+	client.hello(&message.Hello{})
+	disconnect := client.receive().(*message.Disconnect)
+	assert.Equal(t, message.DISCONNECT_PROTOCOL_VERSION, disconnect.Reason)
+	assert.Contains(t, (<-handleCh).Error(), "not matching protocol ID")
+}
+
+func TestServeListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	config := getConfig()
+	config.Port = uint64(l.Addr().(*net.TCPAddr).Port)
+	service := getService(t, config, NewTestPeerKeeper())
+
+	other, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	assert.Error(t, service.Serve(other))
+
+	serveCh := make(chan error, 1)
+	go func() {
+		serveCh <- service.Serve(l)
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	msg, err := message.Receive(conn, nil, func([]byte, []byte) bool { return true }, nil)
+	require.NoError(t, err)
+	assert.Equal(t, config.Port, msg.(*message.Hello).Port)
+
+	require.NoError(t, service.Close())
+	select {
+	case err := <-serveCh:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Serve didn't return after Close")
+	}
+}
+
+func TestDeterministicHello(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	receiveHello := func() *message.Hello {
+		config := getConfig()
+		config.Rand = random.NewSeeded(7)
+		config.Clock = clock.NewFake(now)
+		service := getService(t, config, NewTestPeerKeeper())
+		client := startSession(t, service, make(chan error, 1))
+		defer client.conn.Close()
+		return client.receive().(*message.Hello)
+	}
+	hello1 := receiveHello()
+	hello2 := receiveHello()
+	assert.Equal(t, hello1.RandVal, hello2.RandVal)
+	assert.Equal(t, random.NewSeeded(7).Float64(), hello1.RandVal)
+	assert.Equal(t, uint64(now.Unix()), hello1.GetTimestamp())
+}
@@ -0,0 +1,283 @@
+// Package proxyproto implements the receiving side of the PROXY protocol
+// (versions 1 and 2) used by load balancers to pass the original client
+// address, see https://www.haproxy.org/download/2.0/doc/proxy-protocol.txt
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// V1_MAX_LEN is the maximal length of a v1 header including CRLF.
+	V1_MAX_LEN = 107
+	// V2_HEADER_LEN is the length of the fixed part of a v2 header.
+	V2_HEADER_LEN = 16
+	// V2_MAX_ADDR_LEN bounds the variable part of a v2 header, which may
+	// carry TLVs besides the addresses.
+	V2_MAX_ADDR_LEN = 1024
+)
+
+var (
+	v1Prefix    = []byte("PROXY ")
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+const (
+	v2CmdLocal = 0x0
+	v2CmdProxy = 0x1
+
+	v2FamUnspec = 0x0
+	v2FamInet   = 0x1
+	v2FamInet6  = 0x2
+
+	v2ProtoStream = 0x1
+)
+
+// Header is a parsed PROXY protocol header. Source and Destination are
+// nil when the proxy didn't pass the addresses (v1 UNKNOWN, v2 LOCAL or
+// a non-TCP protocol), the connection's own addresses apply then.
+type Header struct {
+	Version     int
+	Source      *net.TCPAddr
+	Destination *net.TCPAddr
+}
+
+// ReadHeader reads a v1 or v2 header from r.
+func ReadHeader(r *bufio.Reader) (*Header, error) {
+	b, err := r.Peek(len(v1Prefix))
+	if err != nil {
+		return nil, fmt.Errorf("reading PROXY header: %v", err)
+	}
+	if bytes.Equal(b, v1Prefix) {
+		return readV1(r)
+	}
+	b, err = r.Peek(len(v2Signature))
+	if err != nil {
+		return nil, fmt.Errorf("reading PROXY header: %v", err)
+	}
+	if bytes.Equal(b, v2Signature) {
+		return readV2(r)
+	}
+	return nil, fmt.Errorf("missing PROXY header")
+}
+
+func readV1(r *bufio.Reader) (*Header, error) {
+	line := make([]byte, 0, V1_MAX_LEN)
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("reading PROXY v1 header: %v", err)
+		}
+		line = append(line, c)
+		if c == '\n' {
+			break
+		}
+		if len(line) >= V1_MAX_LEN {
+			return nil, fmt.Errorf("PROXY v1 header too long")
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("PROXY v1 header not terminated by CRLF")
+	}
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	header := &Header{Version: 1}
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return header, nil
+	}
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("malformed PROXY v1 header %q", line)
+	}
+	var family string
+	switch fields[1] {
+	case "TCP4":
+		family = "tcp4"
+	case "TCP6":
+		family = "tcp6"
+	default:
+		return nil, fmt.Errorf("unsupported PROXY v1 protocol %q", fields[1])
+	}
+	var err error
+	if header.Source, err = parseV1Addr(family, fields[2], fields[4]); err != nil {
+		return nil, err
+	}
+	if header.Destination, err = parseV1Addr(family, fields[3], fields[5]); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+func parseV1Addr(family, host, port string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(host)
+	if ip == nil || (family == "tcp4") != (ip.To4() != nil) {
+		return nil, fmt.Errorf("invalid PROXY v1 %s address %q", family, host)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PROXY v1 port %q", port)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+func readV2(r *bufio.Reader) (*Header, error) {
+	fixed := make([]byte, V2_HEADER_LEN)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, fmt.Errorf("reading PROXY v2 header: %v", err)
+	}
+	if version := fixed[12] >> 4; version != 2 {
+		return nil, fmt.Errorf("unsupported PROXY v2 version %d", version)
+	}
+	cmd := fixed[12] & 0xf
+	fam := fixed[13] >> 4
+	proto := fixed[13] & 0xf
+	length := int(binary.BigEndian.Uint16(fixed[14:]))
+	if length > V2_MAX_ADDR_LEN {
+		return nil, fmt.Errorf("PROXY v2 header too long: %d", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("reading PROXY v2 addresses: %v", err)
+	}
+
+	header := &Header{Version: 2}
+	switch cmd {
+	case v2CmdLocal:
+		return header, nil
+	case v2CmdProxy:
+	default:
+		return nil, fmt.Errorf("unsupported PROXY v2 command %d", cmd)
+	}
+	if proto != v2ProtoStream {
+		return header, nil
+	}
+	var ipLen int
+	switch fam {
+	case v2FamInet:
+		ipLen = net.IPv4len
+	case v2FamInet6:
+		ipLen = net.IPv6len
+	case v2FamUnspec:
+		return header, nil
+	default:
+		// AF_UNIX has no meaningful client address for us
+		return header, nil
+	}
+	if len(data) < 2*ipLen+4 {
+		return nil, fmt.Errorf("PROXY v2 addresses too short: %d", len(data))
+	}
+	header.Source = &net.TCPAddr{
+		IP:   net.IP(append([]byte(nil), data[:ipLen]...)),
+		Port: int(binary.BigEndian.Uint16(data[2*ipLen:])),
+	}
+	header.Destination = &net.TCPAddr{
+		IP:   net.IP(append([]byte(nil), data[ipLen:2*ipLen]...)),
+		Port: int(binary.BigEndian.Uint16(data[2*ipLen+2:])),
+	}
+	return header, nil
+}
+
+// Conn is a connection with the PROXY header consumed, reporting
+// the addresses passed by the proxy.
+type Conn struct {
+	net.Conn
+	r      *bufio.Reader
+	header *Header
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	if c.header.Source != nil {
+		return c.header.Source
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *Conn) LocalAddr() net.Addr {
+	if c.header.Destination != nil {
+		return c.header.Destination
+	}
+	return c.Conn.LocalAddr()
+}
+
+// ProxyAddr is the address of the proxy which sent the header.
+func (c *Conn) ProxyAddr() net.Addr {
+	return c.Conn.RemoteAddr()
+}
+
+// Wrap reads the PROXY header if conn comes from one of the trusted
+// networks, other connections are returned unchanged since their headers
+// must not be honoured. The header has to arrive within timeout.
+func Wrap(conn net.Conn, trusted []*net.IPNet, timeout time.Duration) (net.Conn, error) {
+	if !isTrusted(conn.RemoteAddr(), trusted) {
+		return conn, nil
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	header, err := ReadHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	return &Conn{Conn: conn, r: r, header: header}, nil
+}
+
+func isTrusted(addr net.Addr, trusted []*net.IPNet) bool {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCIDRs parses a comma separated list of CIDRs, single IPs are
+// treated as /32 or /128 networks.
+func ParseCIDRs(s string) ([]*net.IPNet, error) {
+	res := make([]*net.IPNet, 0)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", item)
+			}
+			if ip4 := ip.To4(); ip4 != nil {
+				res = append(res, &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)})
+			} else {
+				res = append(res, &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)})
+			}
+			continue
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, n)
+	}
+	return res, nil
+}
@@ -0,0 +1,137 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readHeader(t *testing.T, data []byte) (*Header, []byte, error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+	header, err := ReadHeader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	rest, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	return header, rest, nil
+}
+
+func TestV1(t *testing.T) {
+	header, rest, err := readHeader(t, []byte("PROXY TCP4 1.2.3.4 10.0.0.1 51234 40102\r\npayload"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, header.Version)
+	assert.Equal(t, "1.2.3.4:51234", header.Source.String())
+	assert.Equal(t, "10.0.0.1:40102", header.Destination.String())
+	assert.Equal(t, []byte("payload"), rest)
+
+	header, _, err = readHeader(t, []byte("PROXY TCP6 2001:db8::1 2001:db8::2 51234 40102\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "[2001:db8::1]:51234", header.Source.String())
+
+	header, rest, err = readHeader(t, []byte("PROXY UNKNOWN ffff::1 ffff::2 1 2\r\npayload"))
+	require.NoError(t, err)
+	assert.Nil(t, header.Source)
+	assert.Equal(t, []byte("payload"), rest)
+
+	for _, h := range []string{
+		"PROXY TCP4 1.2.3.4 10.0.0.1 51234\r\n",
+		"PROXY TCP4 2001:db8::1 10.0.0.1 51234 40102\r\n",
+		"PROXY TCP4 1.2.3.4 10.0.0.1 70000 40102\r\n",
+		"PROXY UDP4 1.2.3.4 10.0.0.1 51234 40102\r\n",
+		"PROXY TCP4 1.2.3.4 10.0.0.1 51234 40102\n",
+		"PROXY " + strings.Repeat("x", V1_MAX_LEN) + "\r\n",
+		"GET / HTTP/1.1\r\n",
+	} {
+		_, _, err = readHeader(t, []byte(h))
+		assert.Error(t, err, h)
+	}
+}
+
+func v2Header(cmd, fam byte, addrs []byte) []byte {
+	b := append([]byte(nil), v2Signature...)
+	b = append(b, 0x20|cmd, fam<<4|v2ProtoStream, 0, 0)
+	binary.BigEndian.PutUint16(b[14:], uint16(len(addrs)))
+	return append(b, addrs...)
+}
+
+func TestV2(t *testing.T) {
+	addrs := []byte{1, 2, 3, 4, 10, 0, 0, 1, 0xc8, 0x22, 0x9c, 0xa6}
+	header, rest, err := readHeader(t, append(v2Header(v2CmdProxy, v2FamInet, addrs), "payload"...))
+	require.NoError(t, err)
+	assert.Equal(t, 2, header.Version)
+	assert.Equal(t, "1.2.3.4:51234", header.Source.String())
+	assert.Equal(t, "10.0.0.1:40102", header.Destination.String())
+	assert.Equal(t, []byte("payload"), rest)
+
+	addrs = make([]byte, 36)
+	copy(addrs, net.ParseIP("2001:db8::1"))
+	copy(addrs[16:], net.ParseIP("2001:db8::2"))
+	binary.BigEndian.PutUint16(addrs[32:], 51234)
+	// trailing TLVs are skipped
+	addrs = append(addrs, 0x04, 0, 1, 0)
+	header, rest, err = readHeader(t, append(v2Header(v2CmdProxy, v2FamInet6, addrs), "payload"...))
+	require.NoError(t, err)
+	assert.Equal(t, "[2001:db8::1]:51234", header.Source.String())
+	assert.Equal(t, []byte("payload"), rest)
+
+	header, _, err = readHeader(t, v2Header(v2CmdLocal, v2FamUnspec, nil))
+	require.NoError(t, err)
+	assert.Nil(t, header.Source)
+
+	_, _, err = readHeader(t, v2Header(v2CmdProxy, v2FamInet, addrs[:8]))
+	assert.Error(t, err)
+	_, _, err = readHeader(t, v2Header(0x5, v2FamInet, addrs))
+	assert.Error(t, err)
+	tooLong := v2Header(v2CmdProxy, v2FamInet, nil)
+	binary.BigEndian.PutUint16(tooLong[14:], V2_MAX_ADDR_LEN+1)
+	_, _, err = readHeader(t, tooLong)
+	assert.Error(t, err)
+}
+
+type addrConn struct {
+	net.Conn
+	addr net.Addr
+}
+
+func (c *addrConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+func TestWrap(t *testing.T) {
+	trusted, err := ParseCIDRs("10.0.0.0/8, 2001:db8::1")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(trusted))
+	_, err = ParseCIDRs("10.0.0.0/33")
+	assert.Error(t, err)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	untrusted := &addrConn{server, &net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 1}}
+	conn, err := Wrap(untrusted, trusted, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, untrusted, conn)
+
+	proxy := &addrConn{server, &net.TCPAddr{IP: net.ParseIP("10.1.1.1"), Port: 1}}
+	go client.Write([]byte("PROXY TCP4 1.2.3.4 10.0.0.1 51234 40102\r\nhello"))
+	conn, err = Wrap(proxy, trusted, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "1.2.3.4:51234", conn.RemoteAddr().String())
+	assert.Equal(t, "10.1.1.1:1", conn.(*Conn).ProxyAddr().String())
+	buf := make([]byte, 5)
+	_, err = conn.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+
+	// a trusted proxy not sending the header
+	_, err = Wrap(proxy, trusted, 10*time.Millisecond)
+	assert.Error(t, err)
+}
@@ -0,0 +1,122 @@
+package python
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+)
+
+const MAX_PORT = 65535
+
+// KEY_HEX_LEN is the length of a node's hex encoded raw public key.
+const KEY_HEX_LEN = 128
+
+// NatType is a NAT type as reported by pystun in Golem.
+type NatType string
+
+const (
+	NAT_OPEN_INTERNET          NatType = "Open Internet"
+	NAT_FULL_CONE              NatType = "Full Cone"
+	NAT_RESTRICTED             NatType = "Restric NAT"
+	NAT_PORT_RESTRICTED        NatType = "Restric Port NAT"
+	NAT_SYMMETRIC              NatType = "Symmetric NAT"
+	NAT_SYMMETRIC_UDP_FIREWALL NatType = "Symmetric UDP Firewall"
+	NAT_BLOCKED                NatType = "Blocked"
+)
+
+// Known reports whether the type is one of the constants, other values
+// are passed along as they are.
+func (self NatType) Known() bool {
+	switch self {
+	case NAT_OPEN_INTERNET, NAT_FULL_CONE, NAT_RESTRICTED, NAT_PORT_RESTRICTED,
+		NAT_SYMMETRIC, NAT_SYMMETRIC_UDP_FIREWALL, NAT_BLOCKED:
+		return true
+	}
+	return false
+}
+
+type Node struct {
+	NodeName     string    `pyobj:"node_name"`
+	Key          string    `pyobj:"key"`
+	PrvPort      uint64    `pyobj:"prv_port"`
+	PubPort      uint64    `pyobj:"pub_port"`
+	P2pPrvPort   uint64    `pyobj:"p2p_prv_port"`
+	P2pPubPort   uint64    `pyobj:"p2p_pub_port"`
+	PrvAddr      string    `pyobj:"prv_addr"`
+	PubAddr      string    `pyobj:"pub_addr"`
+	PrvAddresses []string  `pyobj:"prv_addresses"`
+	NatType      []NatType `pyobj:"nat_type"`
+}
+
+// ToDict returns the dict representation of golem's Node.
+func (self *Node) ToDict() map[interface{}]interface{} {
+	return toDict(self)
+}
+
+// Validate checks the key is a hex encoded raw public key, the addresses
+// are IPs and the ports fit in 16 bits, empty addresses and zero ports
+// mean unknown.
+func (self *Node) Validate() error {
+	if len(self.Key) != KEY_HEX_LEN {
+		return fmt.Errorf("key of %d hex digits, expected %d", len(self.Key), KEY_HEX_LEN)
+	}
+	if _, err := hex.DecodeString(self.Key); err != nil {
+		return fmt.Errorf("key: %v", err)
+	}
+	ports := []struct {
+		name string
+		port uint64
+	}{
+		{"prv_port", self.PrvPort},
+		{"pub_port", self.PubPort},
+		{"p2p_prv_port", self.P2pPrvPort},
+		{"p2p_pub_port", self.P2pPubPort},
+	}
+	for _, p := range ports {
+		if p.port > MAX_PORT {
+			return fmt.Errorf("%v %d out of range", p.name, p.port)
+		}
+	}
+	if err := validateIP(self.PrvAddr, true); err != nil {
+		return fmt.Errorf("prv_addr: %v", err)
+	}
+	if err := validateIP(self.PubAddr, true); err != nil {
+		return fmt.Errorf("pub_addr: %v", err)
+	}
+	for _, addr := range self.PrvAddresses {
+		if err := validateIP(addr, false); err != nil {
+			return fmt.Errorf("prv_addresses: %v", err)
+		}
+	}
+	return nil
+}
+
+func validateIP(addr string, allowEmpty bool) error {
+	if addr == "" && allowEmpty {
+		return nil
+	}
+	// IPv6 addresses may carry a zone, e.g. fe80::1%eth0
+	host := addr
+	if idx := strings.LastIndex(host, "%"); idx >= 0 && strings.Contains(host, ":") {
+		host = host[:idx]
+	}
+	if net.ParseIP(host) == nil {
+		return fmt.Errorf("invalid IP address %q", addr)
+	}
+	return nil
+}
+
+// DictToNode converts golem's Node dict, accepting any CBOR representation
+// of the values (e.g. ports as signed integers, strings as bytes or a
+// single NAT type instead of a list), and validates the result.
+func DictToNode(m map[interface{}]interface{}) (*Node, error) {
+	res := &Node{}
+	if err := Unmarshal(m, res); err != nil {
+		return nil, err
+	}
+	if err := res.Validate(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,87 @@
+package python
+
+import (
+	"testing"
+
+	"github.com/golemfactory/bootstrap_go/cbor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const TEST_KEY = "ab" + "cdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789" +
+	"abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789"
+
+func testNode() *Node {
+	return &Node{
+		NodeName:     "node",
+		Key:          TEST_KEY,
+		PrvPort:      40102,
+		PubPort:      40102,
+		P2pPrvPort:   40102,
+		P2pPubPort:   40102,
+		PrvAddr:      "10.0.0.1",
+		PubAddr:      "203.0.113.1",
+		PrvAddresses: []string{"10.0.0.1", "fe80::1%eth0"},
+		NatType:      []NatType{NAT_FULL_CONE},
+	}
+}
+
+func TestNodeDictRoundTrip(t *testing.T) {
+	node := testNode()
+	b, err := cbor.Serialize(node.ToDict())
+	require.NoError(t, err)
+	var dict map[interface{}]interface{}
+	require.NoError(t, cbor.Deserialize(b, &dict))
+	decoded, err := DictToNode(dict)
+	require.NoError(t, err)
+	assert.Equal(t, node, decoded)
+	assert.True(t, decoded.NatType[0].Known())
+}
+
+func TestDictToNodeVariants(t *testing.T) {
+	node, err := DictToNode(map[interface{}]interface{}{
+		"node_name":     []byte("node"),
+		"key":           []byte(TEST_KEY),
+		"prv_port":      int64(40102),
+		"pub_port":      uint16(40103),
+		"prv_addr":      "10.0.0.1",
+		"pub_addr":      nil,
+		"prv_addresses": []interface{}{[]byte("10.0.0.2")},
+		"nat_type":      "Symmetric NAT",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "node", node.NodeName)
+	assert.Equal(t, uint64(40102), node.PrvPort)
+	assert.Equal(t, uint64(40103), node.PubPort)
+	assert.Equal(t, "", node.PubAddr)
+	assert.Equal(t, []string{"10.0.0.2"}, node.PrvAddresses)
+	assert.Equal(t, []NatType{NAT_SYMMETRIC}, node.NatType)
+
+	node, err = DictToNode(map[interface{}]interface{}{"key": TEST_KEY, "nat_type": []interface{}{"Something new"}})
+	require.NoError(t, err)
+	assert.False(t, node.NatType[0].Known())
+}
+
+func TestDictToNodeInvalid(t *testing.T) {
+	for _, dict := range []map[interface{}]interface{}{
+		{"prv_port": uint64(65536)},
+		{"p2p_pub_port": int64(-1)},
+		{"pub_port": "40102"},
+		{"prv_addr": "not an ip"},
+		{"pub_addr": "example.com"},
+		{"prv_addresses": []interface{}{"10.0.0.1", uint64(1)}},
+		{"prv_addresses": []interface{}{""}},
+		{"nat_type": map[interface{}]interface{}{}},
+		{"key": uint64(1)},
+		{"key": ""},
+		{"key": "deadbeef"},
+		{"key": TEST_KEY[2:] + "zz"},
+		{"key": TEST_KEY + "00"},
+	} {
+		if _, ok := dict["key"]; !ok {
+			dict["key"] = TEST_KEY
+		}
+		_, err := DictToNode(dict)
+		assert.Error(t, err, "%v", dict)
+	}
+}
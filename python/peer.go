@@ -0,0 +1,47 @@
+package python
+
+import "fmt"
+
+type Peer struct {
+	Address  string `pyobj:"address"`
+	Port     uint64 `pyobj:"port"`
+	Node     *Node  `pyobj:"node"`
+	NodeName string `pyobj:"node_name"`
+	// Record is the Hello the peer connected with, if captured.
+	Record *HelloRecord `pyobj:"hello,omitempty"`
+	// Versions declared in the peer's Hello, not sent to other peers.
+	ClientVer            string
+	GolemMessagesVersion string
+}
+
+func (self *Peer) ToDict() map[interface{}]interface{} {
+	return toDict(self)
+}
+
+// Validate checks the address, port and node of the peer.
+func (self *Peer) Validate() error {
+	if self.Port > MAX_PORT {
+		return fmt.Errorf("port %d out of range", self.Port)
+	}
+	if err := validateIP(self.Address, true); err != nil {
+		return fmt.Errorf("address: %v", err)
+	}
+	if self.Node != nil {
+		if err := self.Node.Validate(); err != nil {
+			return fmt.Errorf("node: %v", err)
+		}
+	}
+	return nil
+}
+
+// DictToPeer converts a peer dict of a Peers message and validates it.
+func DictToPeer(m map[interface{}]interface{}) (*Peer, error) {
+	res := &Peer{}
+	if err := Unmarshal(m, res); err != nil {
+		return nil, err
+	}
+	if err := res.Validate(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -1,74 +1,331 @@
+// Package python converts Go types to and from the dict representation of
+// Golem's Python objects. Struct fields are mapped by their pyobj tags:
+//
+//	Port uint64 `pyobj:"port,omitempty,default=40102"`
+//
+// omitempty leaves zero values out of marshalled dicts, default sets the
+// value of a missing or None key when unmarshalling. Untagged fields are
+// skipped.
 package python
 
 import (
 	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/golemfactory/bootstrap_go/message"
 )
 
-type serializableToDict interface {
-	ToDict() map[interface{}]interface{}
+type fieldTag struct {
+	name      string
+	omitEmpty bool
+	// defaultValue is nil without a default
+	defaultValue *string
 }
 
-func toDict(obj interface{}) map[interface{}]interface{} {
-	m := map[interface{}]interface{}{}
-	v := reflect.ValueOf(obj).Elem()
-	for i := 0; i < v.NumField(); i++ {
-		field := v.Type().Field(i)
-		tag := field.Tag.Get("pyobj")
-		if tag != "" {
-			val := v.Field(i).Interface()
-			if serializableVal, ok := val.(serializableToDict); ok {
-				val = serializableVal.ToDict()
+func parseTag(tag string) fieldTag {
+	parts := strings.Split(tag, ",")
+	res := fieldTag{name: parts[0]}
+	for _, opt := range parts[1:] {
+		switch {
+		case opt == "omitempty":
+			res.omitEmpty = true
+		case strings.HasPrefix(opt, "default="):
+			value := strings.TrimPrefix(opt, "default=")
+			res.defaultValue = &value
+		}
+	}
+	return res
+}
+
+// Marshal converts v to the form sent to Python peers: structs become
+// dicts, slices and arrays lists, named basic types their underlying type.
+func Marshal(v interface{}) (interface{}, error) {
+	return marshal(reflect.ValueOf(v))
+}
+
+func marshal(v reflect.Value) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return marshal(v.Elem())
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			return b, nil
+		}
+		res := make([]interface{}, v.Len())
+		for i := range res {
+			item, err := marshal(v.Index(i))
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %v", i, err)
+			}
+			res[i] = item
+		}
+		return res, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		res := make(map[interface{}]interface{}, v.Len())
+		for _, k := range v.MapKeys() {
+			key, err := marshal(k)
+			if err != nil {
+				return nil, fmt.Errorf("key %v: %v", k, err)
+			}
+			val, err := marshal(v.MapIndex(k))
+			if err != nil {
+				return nil, fmt.Errorf("[%v]: %v", k, err)
 			}
-			m[tag] = val
+			res[key] = val
 		}
+		return res, nil
+	case reflect.Struct:
+		res := make(map[interface{}]interface{})
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			tag := field.Tag.Get("pyobj")
+			if tag == "" {
+				continue
+			}
+			t := parseTag(tag)
+			fv := v.Field(i)
+			if t.omitEmpty && isEmpty(fv) {
+				continue
+			}
+			val, err := marshal(fv)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %v", t.name, err)
+			}
+			res[t.name] = val
+		}
+		return res, nil
 	}
-	return m
+	return nil, fmt.Errorf("unsupported type %v", v.Type())
 }
 
-type Node struct {
-	NodeName     string        `pyobj:"node_name"`
-	Key          string        `pyobj:"key"`
-	PrvPort      uint64        `pyobj:"prv_port"`
-	PubPort      uint64        `pyobj:"pub_port"`
-	P2pPrvPort   uint64        `pyobj:"p2p_prv_port"`
-	P2pPubPort   uint64        `pyobj:"p2p_pub_port"`
-	PrvAddr      string        `pyobj:"prv_addr"`
-	PubAddr      string        `pyobj:"pub_addr"`
-	PrvAddresses []interface{} `pyobj:"prv_addresses"`
-	NatType      []interface{} `pyobj:"nat_type"`
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String, reflect.Array:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	case reflect.Struct:
+		return false
+	}
+	return v.Interface() == reflect.Zero(v.Type()).Interface()
 }
 
-func (self *Node) ToDict() map[interface{}]interface{} {
-	return toDict(self)
+// toDict marshals a struct known to be supported.
+func toDict(obj interface{}) map[interface{}]interface{} {
+	res, err := Marshal(obj)
+	if err != nil {
+		panic(err)
+	}
+	return res.(map[interface{}]interface{})
 }
 
-func DictToNode(m map[interface{}]interface{}) (*Node, error) {
-	res := &Node{}
-	elem := reflect.ValueOf(res).Elem()
-	for i := 0; i < elem.NumField(); i++ {
-		field := elem.Type().Field(i)
-		val := elem.Field(i)
-		tag := field.Tag.Get("pyobj")
-		if tag != "" {
-			if vv, ok := m[tag]; ok && vv != nil {
-				if !reflect.TypeOf(vv).AssignableTo(val.Type()) {
-					return nil, fmt.Errorf("can't assign %v to %v for property %v", reflect.TypeOf(vv), val.Type(), tag)
-				}
-				val.Set(reflect.ValueOf(vv))
-			}
+// Unmarshal sets v, a non-nil pointer, from data as received from a
+// Python peer. Values are converted from any compatible representation
+// (see message.DecodeUint64 and others) and a single value is accepted
+// for a list of strings.
+func Unmarshal(data interface{}, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("unmarshal target must be a non-nil pointer, got %T", v)
+	}
+	return unmarshal(data, rv.Elem())
+}
+
+func unmarshal(data interface{}, v reflect.Value) error {
+	if data == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Interface:
+		val := reflect.ValueOf(data)
+		if !val.Type().AssignableTo(v.Type()) {
+			return &message.TypeError{Got: data, Want: v.Type().String()}
+		}
+		v.Set(val)
+	case reflect.Ptr:
+		elem := reflect.New(v.Type().Elem())
+		if err := unmarshal(data, elem.Elem()); err != nil {
+			return err
+		}
+		v.Set(elem)
+	case reflect.Bool:
+		b, err := message.DecodeBool(data)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.String:
+		s, err := message.DecodeString(data)
+		if err != nil {
+			return err
 		}
+		v.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := message.DecodeInt64(data)
+		if err != nil {
+			return err
+		}
+		if v.OverflowInt(i) {
+			return fmt.Errorf("%v out of %v range", i, v.Type())
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := message.DecodeUint64(data)
+		if err != nil {
+			return err
+		}
+		if v.OverflowUint(u) {
+			return fmt.Errorf("%v out of %v range", u, v.Type())
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := message.DecodeFloat64(data)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		return unmarshalSlice(data, v)
+	case reflect.Map:
+		return unmarshalMap(data, v)
+	case reflect.Struct:
+		return unmarshalStruct(data, v)
+	default:
+		return fmt.Errorf("unsupported type %v", v.Type())
 	}
-	return res, nil
+	return nil
 }
 
-type Peer struct {
-	Address  string `pyobj:"address"`
-	Port     uint64 `pyobj:"port"`
-	Node     *Node  `pyobj:"node"`
-	NodeName string `pyobj:"node_name"`
+func unmarshalSlice(data interface{}, v reflect.Value) error {
+	if v.Type().Elem().Kind() == reflect.Uint8 {
+		b, err := message.DecodeBytes(data)
+		if err != nil {
+			return err
+		}
+		v.SetBytes(append([]byte(nil), b...))
+		return nil
+	}
+	list, err := message.DecodeList(data)
+	if err != nil {
+		if _, ok := data.(string); !ok || v.Type().Elem().Kind() != reflect.String {
+			return err
+		}
+		list = []interface{}{data}
+	}
+	res := reflect.MakeSlice(v.Type(), len(list), len(list))
+	for idx, item := range list {
+		if err := unmarshal(item, res.Index(idx)); err != nil {
+			return fmt.Errorf("[%d]: %v", idx, err)
+		}
+	}
+	v.Set(res)
+	return nil
 }
 
-func (self *Peer) ToDict() map[interface{}]interface{} {
-	return toDict(self)
+func unmarshalMap(data interface{}, v reflect.Value) error {
+	m, err := message.DecodeMap(data)
+	if err != nil {
+		return err
+	}
+	res := reflect.MakeMapWithSize(v.Type(), len(m))
+	for k, item := range m {
+		key := reflect.New(v.Type().Key()).Elem()
+		if err := unmarshal(k, key); err != nil {
+			return fmt.Errorf("key %v: %v", k, err)
+		}
+		val := reflect.New(v.Type().Elem()).Elem()
+		if err := unmarshal(item, val); err != nil {
+			return fmt.Errorf("[%v]: %v", k, err)
+		}
+		res.SetMapIndex(key, val)
+	}
+	v.Set(res)
+	return nil
+}
+
+func unmarshalStruct(data interface{}, v reflect.Value) error {
+	m, err := message.DecodeMap(data)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < v.NumField(); i++ {
+		tag := v.Type().Field(i).Tag.Get("pyobj")
+		if tag == "" {
+			continue
+		}
+		t := parseTag(tag)
+		fv := v.Field(i)
+		item := m[t.name]
+		if item == nil && t.defaultValue != nil {
+			if err := setDefault(*t.defaultValue, fv); err != nil {
+				return fmt.Errorf("%v: default: %v", t.name, err)
+			}
+			continue
+		}
+		if err := unmarshal(item, fv); err != nil {
+			return fmt.Errorf("%v: %v", t.name, err)
+		}
+	}
+	return nil
+}
+
+func setDefault(value string, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+		return nil
+	}
+	return fmt.Errorf("unsupported type %v", v.Type())
 }
@@ -0,0 +1,103 @@
+package python
+
+import (
+	"testing"
+
+	"github.com/golemfactory/bootstrap_go/cbor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testInner struct {
+	Name  string `pyobj:"name"`
+	Ratio float64
+}
+
+type testOuter struct {
+	Port     uint16               `pyobj:"port,default=40102"`
+	Secure   bool                 `pyobj:"secure,default=true"`
+	Comment  string               `pyobj:"comment,omitempty"`
+	Inner    testInner            `pyobj:"inner"`
+	Optional *testInner           `pyobj:"optional"`
+	List     []*testInner         `pyobj:"list"`
+	ByName   map[string]testInner `pyobj:"by_name"`
+	Counts   map[string]int       `pyobj:"counts,omitempty"`
+	Raw      interface{}          `pyobj:"raw"`
+	Types    []NatType            `pyobj:"types"`
+	Key      []byte               `pyobj:"key"`
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	v := &testOuter{
+		Port:     1234,
+		Secure:   false,
+		Inner:    testInner{Name: "inner"},
+		Optional: &testInner{Name: "optional"},
+		List:     []*testInner{{Name: "a"}, nil},
+		ByName:   map[string]testInner{"b": {Name: "b"}},
+		Counts:   map[string]int{"c": -1},
+		Raw:      []interface{}{"x", uint64(1)},
+		Types:    []NatType{NAT_BLOCKED},
+		Key:      []byte{0xde, 0xad},
+	}
+	data, err := Marshal(v)
+	require.NoError(t, err)
+	dict := data.(map[interface{}]interface{})
+	assert.NotContains(t, dict, "comment")
+	assert.Equal(t, map[interface{}]interface{}{"name": "inner"}, dict["inner"])
+	assert.Equal(t, []interface{}{"Blocked"}, dict["types"])
+
+	b, err := cbor.Serialize(data)
+	require.NoError(t, err)
+	var received interface{}
+	require.NoError(t, cbor.Deserialize(b, &received))
+	decoded := &testOuter{}
+	require.NoError(t, Unmarshal(received, decoded))
+	assert.Equal(t, v, decoded)
+}
+
+func TestUnmarshalDefaults(t *testing.T) {
+	v := &testOuter{}
+	require.NoError(t, Unmarshal(map[interface{}]interface{}{"port": nil, "comment": "x"}, v))
+	assert.Equal(t, uint16(40102), v.Port)
+	assert.True(t, v.Secure)
+	assert.Equal(t, "x", v.Comment)
+	assert.Nil(t, v.Optional)
+	assert.Nil(t, v.List)
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	for _, data := range []interface{}{
+		"not a dict",
+		map[interface{}]interface{}{"port": uint64(1 << 16)},
+		map[interface{}]interface{}{"inner": map[interface{}]interface{}{"name": uint64(1)}},
+		map[interface{}]interface{}{"list": []interface{}{"x"}},
+		map[interface{}]interface{}{"by_name": map[interface{}]interface{}{uint64(1): map[interface{}]interface{}{}}},
+	} {
+		assert.Error(t, Unmarshal(data, &testOuter{}), "%v", data)
+	}
+	err := Unmarshal(map[interface{}]interface{}{"list": []interface{}{nil, "x"}}, &testOuter{})
+	require.Error(t, err)
+	assert.Equal(t, "list: [1]: got string, want map", err.Error())
+	assert.Error(t, Unmarshal(map[interface{}]interface{}{}, testOuter{}))
+}
+
+func TestPeerDictRoundTrip(t *testing.T) {
+	peer := &Peer{Address: "203.0.113.1", Port: 40102, Node: testNode(), NodeName: "node"}
+	b, err := cbor.Serialize(peer.ToDict())
+	require.NoError(t, err)
+	var dict map[interface{}]interface{}
+	require.NoError(t, cbor.Deserialize(b, &dict))
+	decoded, err := DictToPeer(dict)
+	require.NoError(t, err)
+	assert.Equal(t, peer, decoded)
+
+	noNode, err := DictToPeer(map[interface{}]interface{}{"address": "203.0.113.1", "node": nil})
+	require.NoError(t, err)
+	assert.Nil(t, noNode.Node)
+
+	_, err = DictToPeer(map[interface{}]interface{}{"address": "203.0.113.1", "port": uint64(70000)})
+	assert.Error(t, err)
+	_, err = DictToPeer(map[interface{}]interface{}{"node": map[interface{}]interface{}{"prv_addr": "x"}})
+	assert.Error(t, err)
+}
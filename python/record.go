@@ -0,0 +1,89 @@
+package python
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/golemfactory/bootstrap_go/crypto"
+	"github.com/golemfactory/bootstrap_go/message"
+)
+
+// RECORD_KEY_LEN is the length of the raw public key of a node.
+const RECORD_KEY_LEN = 64
+
+var ErrNoRecord = errors.New("peer has no signed record")
+
+// HelloRecord is the Hello sent by the peer to the bootstrap, signed by
+// the peer itself, so the node info can be verified by anyone receiving
+// the peer, also from a cache or another bootstrap.
+type HelloRecord struct {
+	Timestamp uint64 `pyobj:"timestamp"`
+	// Payload is the serialized payload of the Hello.
+	Payload   []byte `pyobj:"payload"`
+	Signature []byte `pyobj:"signature"`
+}
+
+// NewHelloRecord captures the record of a received Hello.
+func NewHelloRecord(hello *message.Hello) *HelloRecord {
+	return &HelloRecord{
+		Timestamp: hello.GetTimestamp(),
+		Payload:   hello.RawPayload(),
+		Signature: hello.GetSignature(),
+	}
+}
+
+// Verify checks the signature of the Hello by the key of the node it
+// carries and returns the Hello.
+func (self *HelloRecord) Verify() (*message.Hello, *Node, error) {
+	hello := &message.Hello{}
+	if err := message.DecodePayload(self.Payload, hello, nil); err != nil {
+		return nil, nil, fmt.Errorf("malformed Hello: %v", err)
+	}
+	node, err := DictToNode(hello.NodeInfo)
+	if err != nil {
+		return nil, nil, fmt.Errorf("malformed node info: %v", err)
+	}
+	keyBytes, err := hex.DecodeString(node.Key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("malformed node key: %v", err)
+	}
+	if len(keyBytes) != RECORD_KEY_LEN {
+		return nil, nil, fmt.Errorf("node key of %d bytes, expected %d", len(keyBytes), RECORD_KEY_LEN)
+	}
+	if len(self.Signature) != message.SIG_LEN {
+		return nil, nil, fmt.Errorf("signature of %d bytes, expected %d", len(self.Signature), message.SIG_LEN)
+	}
+	key, err := crypto.PublicKeyFromBytes(append([]byte{0x04}, keyBytes...))
+	if err != nil {
+		return nil, nil, fmt.Errorf("malformed node key: %v", err)
+	}
+	shortHash, err := message.ComputeShortHash(message.MSG_HELLO_TYPE, self.Timestamp, self.Payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !key.VerifySign(message.ShortHashSha(shortHash), self.Signature) {
+		return nil, nil, message.ErrIncorrectSignature
+	}
+	hello.SetTimestamp(self.Timestamp)
+	hello.SetSignature(self.Signature)
+	return hello, node, nil
+}
+
+// VerifyRecord checks the peer's record and that it was signed by the
+// peer's node. It returns the node as declared by the peer, the public
+// address of the peer record may differ as it's the one observed by
+// the bootstrap.
+func (self *Peer) VerifyRecord() (*Node, error) {
+	if self.Record == nil {
+		return nil, ErrNoRecord
+	}
+	_, node, err := self.Record.Verify()
+	if err != nil {
+		return nil, err
+	}
+	if self.Node == nil || node.Key != self.Node.Key {
+		return nil, fmt.Errorf("record signed by another node")
+	}
+	return node, nil
+}
@@ -0,0 +1,134 @@
+package python
+
+import (
+	"testing"
+
+	"github.com/golemfactory/bootstrap_go/crypto"
+	"github.com/golemfactory/bootstrap_go/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signedHello returns a Hello with the given node signed with sig.
+func signedHello(t *testing.T, node *Node, sig []byte) *message.Hello {
+	sign := func([]byte) ([]byte, error) { return sig, nil }
+	serialized, err := message.Serialize(&message.Hello{
+		Port:     40102,
+		NodeInfo: node.ToDict(),
+	}, nil, sign)
+	require.NoError(t, err)
+	verifySign := func([]byte, []byte) bool { return true }
+	msg, err := message.Deserialize(serialized, nil, verifySign, nil)
+	require.NoError(t, err)
+	return msg.(*message.Hello)
+}
+
+// signedPeer returns a peer whose record is a Hello signed by privKey and
+// received as by the bootstrap.
+func signedPeer(t *testing.T, privKey crypto.PrivateKey) Peer {
+	pubKey := privKey.GetPublicKey()
+	node := &Node{Key: pubKey.Hex(), PubAddr: "203.0.113.1", P2pPrvPort: 40102}
+	sign := func(shortHash []byte) ([]byte, error) {
+		return privKey.Sign(message.ShortHashSha(shortHash))
+	}
+	serialized, err := message.Serialize(&message.Hello{
+		Port:     40102,
+		NodeName: "signed",
+		NodeInfo: node.ToDict(),
+	}, nil, sign)
+	require.NoError(t, err)
+	verifySign := func([]byte, []byte) bool { return true }
+	msg, err := message.Deserialize(serialized, nil, verifySign, nil)
+	require.NoError(t, err)
+	return Peer{
+		Address: "203.0.113.1",
+		Port:    40102,
+		Node:    node,
+		Record:  NewHelloRecord(msg.(*message.Hello)),
+	}
+}
+
+func TestVerifyRecord(t *testing.T) {
+	privKey, err := crypto.GeneratePrivateKey()
+	require.NoError(t, err)
+	peer := signedPeer(t, privKey)
+
+	node, err := peer.VerifyRecord()
+	require.NoError(t, err)
+	assert.Equal(t, peer.Node.Key, node.Key)
+
+	// the record survives the round trip through the Peers dicts
+	decoded, err := DictToPeer(peer.ToDict())
+	require.NoError(t, err)
+	_, err = decoded.VerifyRecord()
+	assert.NoError(t, err)
+
+	// the bootstrap may replace the declared public address
+	peer.Node = &Node{Key: peer.Node.Key, PubAddr: "198.51.100.1"}
+	_, err = peer.VerifyRecord()
+	assert.NoError(t, err)
+}
+
+func TestVerifyRecordErrors(t *testing.T) {
+	privKey, err := crypto.GeneratePrivateKey()
+	require.NoError(t, err)
+	otherKey, err := crypto.GeneratePrivateKey()
+	require.NoError(t, err)
+
+	_, err = (&Peer{}).VerifyRecord()
+	assert.Equal(t, ErrNoRecord, err)
+
+	peer := signedPeer(t, privKey)
+	peer.Record.Timestamp++
+	_, err = peer.VerifyRecord()
+	assert.Equal(t, message.ErrIncorrectSignature, err)
+
+	peer = signedPeer(t, privKey)
+	payload := append([]byte(nil), peer.Record.Payload...)
+	payload[len(payload)-1] ^= 1
+	peer.Record.Payload = payload
+	_, err = peer.VerifyRecord()
+	assert.Error(t, err)
+
+	// a valid record of another node
+	peer = signedPeer(t, privKey)
+	other := signedPeer(t, otherKey)
+	peer.Record = other.Record
+	_, err = peer.VerifyRecord()
+	assert.Error(t, err)
+
+	// the Hello is signed by the key it declares only
+	peer = signedPeer(t, privKey)
+	peer.Record.Signature = other.Record.Signature
+	_, err = peer.VerifyRecord()
+	assert.Equal(t, message.ErrIncorrectSignature, err)
+}
+
+func TestVerifyRecordTruncated(t *testing.T) {
+	privKey, err := crypto.GeneratePrivateKey()
+	require.NoError(t, err)
+	pubKey := privKey.GetPublicKey()
+
+	node := &Node{Key: "04abcd"}
+	hello := signedHello(t, node, make([]byte, message.SIG_LEN))
+	peer := Peer{Node: node, Record: NewHelloRecord(hello)}
+	_, err = peer.VerifyRecord()
+	assert.Error(t, err)
+
+	peer = signedPeer(t, privKey)
+	peer.Record.Signature = peer.Record.Signature[:10]
+	_, err = peer.VerifyRecord()
+	assert.Error(t, err)
+
+	peer.Record.Signature = nil
+	_, err = peer.VerifyRecord()
+	assert.Error(t, err)
+
+	// a valid key with a short signature
+	node = &Node{Key: pubKey.Hex()}
+	hello = signedHello(t, node, make([]byte, message.SIG_LEN))
+	peer = Peer{Node: node, Record: NewHelloRecord(hello)}
+	peer.Record.Signature = peer.Record.Signature[:message.SIG_LEN-1]
+	_, err = peer.VerifyRecord()
+	assert.Error(t, err)
+}
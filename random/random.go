@@ -0,0 +1,66 @@
+// Package random abstracts the sources of randomness so that code using
+// them can be made deterministic in tests.
+package random
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"math/rand"
+	"sync"
+)
+
+// Rand is the subset of math/rand used by the bootstrap.
+// Implementations should be thread safe.
+type Rand interface {
+	// Float64 returns a number in [0.0, 1.0).
+	Float64() float64
+	// Intn returns a number in [0, n), it panics if n <= 0.
+	Intn(n int) int
+}
+
+type secureSource struct{}
+
+func (secureSource) Int63() int64 {
+	var b [8]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		panic("crypto/rand failed: " + err.Error())
+	}
+	return int64(binary.BigEndian.Uint64(b[:]) &^ (1 << 63))
+}
+
+func (secureSource) Seed(int64) {}
+
+// Secure returns the Rand backed by crypto/rand, suitable for nonces.
+// It's thread safe since the source is stateless.
+func Secure() Rand {
+	return rand.New(secureSource{})
+}
+
+type seeded struct {
+	mutex sync.Mutex
+	rand  *rand.Rand
+}
+
+// NewSeeded returns a deterministic Rand for tests.
+func NewSeeded(seed int64) Rand {
+	return &seeded{rand: rand.New(rand.NewSource(seed))}
+}
+
+func (r *seeded) Float64() float64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.rand.Float64()
+}
+
+func (r *seeded) Intn(n int) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.rand.Intn(n)
+}
+
+// Shuffle permutes n elements with swap, like rand.Shuffle.
+func Shuffle(r Rand, n int, swap func(i, j int)) {
+	for i := n - 1; i > 0; i-- {
+		swap(i, r.Intn(i+1))
+	}
+}
@@ -0,0 +1,43 @@
+package random
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeeded(t *testing.T) {
+	r1 := NewSeeded(42)
+	r2 := NewSeeded(42)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, r1.Float64(), r2.Float64())
+		assert.Equal(t, r1.Intn(100), r2.Intn(100))
+	}
+}
+
+func TestSecure(t *testing.T) {
+	r := Secure()
+	seen := make(map[float64]bool)
+	for i := 0; i < 100; i++ {
+		f := r.Float64()
+		assert.True(t, f >= 0 && f < 1)
+		seen[f] = true
+		n := r.Intn(7)
+		assert.True(t, n >= 0 && n < 7)
+	}
+	assert.Equal(t, 100, len(seen))
+}
+
+func TestShuffle(t *testing.T) {
+	r := NewSeeded(1)
+	firsts := make(map[int]bool)
+	for i := 0; i < 100; i++ {
+		values := []int{0, 1, 2, 3, 4}
+		Shuffle(r, len(values), func(i, j int) {
+			values[i], values[j] = values[j], values[i]
+		})
+		assert.ElementsMatch(t, []int{0, 1, 2, 3, 4}, values)
+		firsts[values[0]] = true
+	}
+	assert.Equal(t, 5, len(firsts))
+}
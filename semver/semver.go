@@ -0,0 +1,216 @@
+package semver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Version struct {
+	Major uint64
+	Minor uint64
+	Patch uint64
+	// Prerelease is the part after '-', build metadata is dropped.
+	Prerelease string
+}
+
+// Parse parses "MAJOR.MINOR.PATCH[-PRERELEASE][+BUILD]".
+func Parse(s string) (Version, error) {
+	var v Version
+	rest := s
+	if idx := strings.IndexByte(rest, '+'); idx >= 0 {
+		rest = rest[:idx]
+	}
+	if idx := strings.IndexByte(rest, '-'); idx >= 0 {
+		v.Prerelease = rest[idx+1:]
+		rest = rest[:idx]
+		if v.Prerelease == "" {
+			return Version{}, fmt.Errorf("invalid version %q: empty prerelease", s)
+		}
+	}
+	parts := strings.Split(rest, ".")
+	if len(parts) != 3 {
+		return Version{}, fmt.Errorf("invalid version %q", s)
+	}
+	nums := []*uint64{&v.Major, &v.Minor, &v.Patch}
+	for idx, p := range parts {
+		n, err := strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			return Version{}, fmt.Errorf("invalid version %q", s)
+		}
+		*nums[idx] = n
+	}
+	return v, nil
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1. A prerelease is lower than the release.
+func (v Version) Compare(o Version) int {
+	if c := compareUint(v.Major, o.Major); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Minor, o.Minor); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Patch, o.Patch); c != 0 {
+		return c
+	}
+	switch {
+	case v.Prerelease == o.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case o.Prerelease == "":
+		return -1
+	case v.Prerelease < o.Prerelease:
+		return -1
+	}
+	return 1
+}
+
+// Compatible tells whether both versions belong to the same MAJOR.MINOR
+// series.
+func (v Version) Compatible(o Version) bool {
+	return v.Major == o.Major && v.Minor == o.Minor
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+const wildcard = -1
+
+// pattern is a version with optional wildcards, e.g. 2.24.x
+type pattern [3]int64
+
+func parsePattern(s string) (pattern, error) {
+	var p pattern
+	parts := strings.Split(s, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return p, fmt.Errorf("invalid version pattern %q", s)
+	}
+	for idx := range p {
+		if idx >= len(parts) || parts[idx] == "x" || parts[idx] == "*" {
+			p[idx] = wildcard
+			continue
+		}
+		if idx > 0 && p[idx-1] == wildcard {
+			return p, fmt.Errorf("invalid version pattern %q: number after wildcard", s)
+		}
+		n, err := strconv.ParseUint(parts[idx], 10, 63)
+		if err != nil {
+			return p, fmt.Errorf("invalid version pattern %q", s)
+		}
+		p[idx] = int64(n)
+	}
+	return p, nil
+}
+
+// compare returns -1 if v is below every version matching the pattern,
+// 1 if it's above all of them and 0 if it matches.
+func (p pattern) compare(v Version) int {
+	nums := []uint64{v.Major, v.Minor, v.Patch}
+	for idx, n := range nums {
+		if p[idx] == wildcard {
+			return 0
+		}
+		if c := compareUint(n, uint64(p[idx])); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func (p pattern) String() string {
+	parts := make([]string, len(p))
+	for idx, n := range p {
+		if n == wildcard {
+			parts[idx] = "x"
+		} else {
+			parts[idx] = strconv.FormatInt(n, 10)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// Range is an inclusive range of versions whose bounds may contain
+// wildcards, e.g. "2.24.x-2.26.x" or just "2.25.x".
+type Range struct {
+	min pattern
+	max pattern
+}
+
+func ParseRange(s string) (Range, error) {
+	s = strings.TrimSpace(s)
+	bounds := strings.Split(s, "-")
+	if len(bounds) > 2 {
+		return Range{}, fmt.Errorf("invalid version range %q", s)
+	}
+	min, err := parsePattern(strings.TrimSpace(bounds[0]))
+	if err != nil {
+		return Range{}, err
+	}
+	max := min
+	if len(bounds) == 2 {
+		max, err = parsePattern(strings.TrimSpace(bounds[1]))
+		if err != nil {
+			return Range{}, err
+		}
+	}
+	return Range{min, max}, nil
+}
+
+// ParseRanges parses a comma separated list of ranges.
+func ParseRanges(s string) ([]Range, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var ranges []Range
+	for _, part := range strings.Split(s, ",") {
+		r, err := ParseRange(part)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+// Contains ignores the prerelease part of v.
+func (r Range) Contains(v Version) bool {
+	return r.min.compare(v) >= 0 && r.max.compare(v) <= 0
+}
+
+func (r Range) String() string {
+	if r.min == r.max {
+		return r.min.String()
+	}
+	return r.min.String() + "-" + r.max.String()
+}
+
+// Satisfies tells whether v is contained in any of the ranges. An empty
+// list of ranges accepts every version.
+func Satisfies(v Version, ranges []Range) bool {
+	if len(ranges) == 0 {
+		return true
+	}
+	for _, r := range ranges {
+		if r.Contains(v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package semver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	v, err := Parse("2.24.3")
+	require.NoError(t, err)
+	assert.Equal(t, Version{2, 24, 3, ""}, v)
+	v, err = Parse("0.20.0-rc1+abc")
+	require.NoError(t, err)
+	assert.Equal(t, Version{0, 20, 0, "rc1"}, v)
+	assert.Equal(t, "0.20.0-rc1", v.String())
+
+	for _, s := range []string{"", "2.24", "2.24.x", "a.b.c", "1.2.3-"} {
+		_, err := Parse(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	parse := func(s string) Version {
+		v, err := Parse(s)
+		require.NoError(t, err)
+		return v
+	}
+	assert.Equal(t, -1, parse("2.24.3").Compare(parse("2.25.0")))
+	assert.Equal(t, 1, parse("3.0.0").Compare(parse("2.99.99")))
+	assert.Equal(t, 0, parse("1.2.3").Compare(parse("1.2.3+build")))
+	assert.Equal(t, -1, parse("1.2.3-rc1").Compare(parse("1.2.3")))
+	assert.True(t, parse("2.24.0").Compatible(parse("2.24.9")))
+	assert.False(t, parse("2.24.0").Compatible(parse("2.25.0")))
+}
+
+func TestRange(t *testing.T) {
+	ranges, err := ParseRanges("2.24.x-2.26.x, 3.1.4")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(ranges))
+	assert.Equal(t, "2.24.x-2.26.x", ranges[0].String())
+
+	for s, expected := range map[string]bool{
+		"2.23.9":  false,
+		"2.24.0":  true,
+		"2.25.17": true,
+		"2.26.99": true,
+		"2.27.0":  false,
+		"3.1.4":   true,
+		"3.1.5":   false,
+	} {
+		v, err := Parse(s)
+		require.NoError(t, err)
+		assert.Equal(t, expected, Satisfies(v, ranges), s)
+	}
+	assert.True(t, Satisfies(Version{9, 9, 9, ""}, nil))
+
+	for _, s := range []string{"2.x.1", "1-2-3", "2.24.y"} {
+		_, err := ParseRange(s)
+		assert.Error(t, err, s)
+	}
+}
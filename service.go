@@ -2,97 +2,374 @@ package bootstrap
 
 import (
 	"fmt"
-	"math/rand"
 	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/golemfactory/bootstrap_go/ban"
+	"github.com/golemfactory/bootstrap_go/clock"
 	"github.com/golemfactory/bootstrap_go/crypto"
+	"github.com/golemfactory/bootstrap_go/logging"
 	"github.com/golemfactory/bootstrap_go/message"
 	"github.com/golemfactory/bootstrap_go/peerkeeper"
+	"github.com/golemfactory/bootstrap_go/proxyproto"
 	"github.com/golemfactory/bootstrap_go/python"
+	"github.com/golemfactory/bootstrap_go/random"
+	"github.com/golemfactory/bootstrap_go/semver"
 )
 
+type SessionMode int
+
+const (
+	// SESSION_MODE_BOOTSTRAP pushes peers to the client and disconnects
+	// right after the handshake.
+	SESSION_MODE_BOOTSTRAP SessionMode = iota
+	// SESSION_MODE_LONG_LIVED keeps the session open after pushing peers,
+	// answering GetPeers and Ping until the client goes idle.
+	SESSION_MODE_LONG_LIVED
+)
+
+const DEFAULT_IDLE_TIMEOUT = 60 * time.Second
+
+const DEFAULT_HANDSHAKE_TIMEOUT = 10 * time.Second
+
+const DEFAULT_WRITE_TIMEOUT = 10 * time.Second
+
+// ACCEPT_RETRY_DELAY is the pause after a temporary accept error, e.g.
+// running out of file descriptors.
+const ACCEPT_RETRY_DELAY = 100 * time.Millisecond
+
+// PROXY_HEADER_TIMEOUT bounds the wait for the PROXY protocol header.
+const PROXY_HEADER_TIMEOUT = 5 * time.Second
+
+// Config describes the bootstrap node and the primary network it serves,
+// more networks can be added with Service.AddNetwork.
 type Config struct {
 	Name                 string
 	Id                   string
 	Port                 uint64
 	PrvAddr              string
 	PubAddr              string
-	PrvAddresses         []interface{}
-	NatType              []interface{}
+	PrvAddresses         []string
+	NatType              []python.NatType
 	PeerNum              int
 	ProtocolId           string
 	GolemMessagesVersion string
 	GolemVersion         string
+	SessionMode          SessionMode
+	// AcceptedGolemMessagesVersions and AcceptedGolemVersions restrict the
+	// versions declared by connecting peers, empty lists accept any.
+	AcceptedGolemMessagesVersions []semver.Range
+	AcceptedGolemVersions         []semver.Range
+	// HandshakeTimeout bounds the handshake and, in SESSION_MODE_BOOTSTRAP,
+	// the whole session. Defaults to DEFAULT_HANDSHAKE_TIMEOUT when zero.
+	HandshakeTimeout time.Duration
+	// IdleTimeout applies to SESSION_MODE_LONG_LIVED, defaults to
+	// DEFAULT_IDLE_TIMEOUT when zero.
+	IdleTimeout time.Duration
+	// WriteTimeout bounds each response in SESSION_MODE_LONG_LIVED, so
+	// clients not reading them can't hold the session, defaults to
+	// DEFAULT_WRITE_TIMEOUT.
+	WriteTimeout time.Duration
+	// MaxClockSkew is the maximal allowed difference between the timestamp
+	// of a received message and the local clock. Zero disables the check
+	// and the replay protection of handshake messages.
+	MaxClockSkew time.Duration
+	// Clock defaults to the system clock.
+	Clock clock.Clock
+	// Rand generates the handshake nonces, defaults to a cryptographically
+	// secure source.
+	Rand random.Rand
+	// Logger defaults to a logger discarding everything.
+	Logger logging.Logger
+	// ListenAddrs are the local addresses (IPv4 or IPv6, e.g. "0.0.0.0",
+	// "::1" or "fe80::1%eth0") on which each network's port is bound.
+	// When empty, all the addresses of both families are used.
+	ListenAddrs []string
+	// ProxyTrusted enables the PROXY protocol for connections from these
+	// networks, e.g. load balancers. The addresses passed by them are used
+	// for peer records and bans.
+	ProxyTrusted []*net.IPNet
+	// AllowReservedAddresses stores peers connecting from loopback,
+	// private and other non-public addresses, e.g. for local networks.
+	AllowReservedAddresses bool
+	// SendPeerRecords includes the signed Hello records of the peers in
+	// Peers messages, so the receivers can verify the entries.
+	SendPeerRecords bool
+	// Bans is optional, when set banned IPs and node keys are rejected
+	// and never stored in nor returned from the PeerKeeper.
+	Bans *ban.List
 }
 
 type Service struct {
 	config     *Config
 	privKey    crypto.PrivateKey
 	pubKeyHex  string
-	peerKeeper peerkeeper.PeerKeeper
+	networks   []*Network
+	log        logging.Logger
+	sessionNum uint64
+	handlers   map[uint16]HandlerFunc
+	hooks      []Hooks
+	clock      clock.Clock
+	rand       random.Rand
+	// replayCache is nil if the replay protection is disabled.
+	replayCache *message.ReplayCache
+
+	mutex     sync.Mutex
+	listeners []net.Listener
+	closed    bool
 }
 
 func NewService(config *Config, privKey crypto.PrivateKey, pk peerkeeper.PeerKeeper) *Service {
 	pubKey := privKey.GetPublicKey()
 	pubKeyHex := pubKey.Hex()
-	return &Service{
-		config:     config,
-		privKey:    privKey,
-		pubKeyHex:  pubKeyHex,
-		peerKeeper: pk,
+	log := config.Logger
+	if log == nil {
+		log = logging.NewNopLogger()
+	}
+	c := config.Clock
+	if c == nil {
+		c = clock.System()
+	}
+	r := config.Rand
+	if r == nil {
+		r = random.Secure()
+	}
+	s := &Service{
+		config:    config,
+		privKey:   privKey,
+		pubKeyHex: pubKeyHex,
+		log:       log,
+		handlers:  make(map[uint16]HandlerFunc),
+		clock:     c,
+		rand:      r,
 	}
+	if config.MaxClockSkew > 0 {
+		// older messages are rejected by the timestamp check anyway
+		s.replayCache = message.NewReplayCache(2*config.MaxClockSkew, c)
+	}
+	s.registerDefaultHandlers()
+	if err := s.AddNetwork(primaryNetwork(config, pk)); err != nil {
+		panic(err)
+	}
+	return s
 }
 
+// Listen serves all the networks, each on its own port of every
+// listen address.
 func (s *Service) Listen() error {
-	l, err := net.Listen("tcp", fmt.Sprintf(":%d", s.config.Port))
+	listeners, err := s.Bind()
 	if err != nil {
 		return err
 	}
-	defer l.Close()
-	fmt.Printf("Listening on port %d\n", s.config.Port)
+	return s.Serve(listeners...)
+}
+
+// Bind opens the listeners of all the networks without accepting
+// connections yet.
+func (s *Service) Bind() ([]net.Listener, error) {
+	hosts := s.config.ListenAddrs
+	if len(hosts) == 0 {
+		hosts = []string{""}
+	}
+	listeners := make([]net.Listener, 0, len(s.networks)*len(hosts))
+	for _, n := range s.networks {
+		for _, host := range hosts {
+			l, err := net.Listen("tcp", listenAddr(host, n.Port))
+			if err != nil {
+				for _, l := range listeners {
+					l.Close()
+				}
+				return nil, err
+			}
+			listeners = append(listeners, l)
+		}
+	}
+	return listeners, nil
+}
+
+// Serve accepts connections on externally provided listeners, e.g.
+// inherited through socket activation. Each listener serves the network
+// with the same port. It returns after Close or on the first accept error.
+func (s *Service) Serve(listeners ...net.Listener) error {
+	networks := make([]*Network, len(listeners))
+	for idx, l := range listeners {
+		n, err := s.listenerNetwork(l)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return err
+		}
+		networks[idx] = n
+	}
+
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		for _, l := range listeners {
+			l.Close()
+		}
+		return nil
+	}
+	s.listeners = append(s.listeners, listeners...)
+	s.mutex.Unlock()
+
+	errCh := make(chan error, len(listeners))
+	for idx, l := range listeners {
+		go func(l net.Listener, n *Network) {
+			errCh <- s.serve(l, n)
+		}(l, networks[idx])
+	}
+	err := <-errCh
+	for _, l := range listeners {
+		l.Close()
+	}
+	return err
+}
+
+func (s *Service) listenerNetwork(l net.Listener) (*Network, error) {
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range s.networks {
+		if strconv.FormatUint(n.Port, 10) == port {
+			return n, nil
+		}
+	}
+	return nil, fmt.Errorf("no network with port %v for listener %v", port, l.Addr())
+}
+
+// Close stops accepting connections, sessions already running are
+// not interrupted.
+func (s *Service) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+	for _, l := range s.listeners {
+		l.Close()
+	}
+	s.listeners = nil
+	return nil
+}
+
+func (s *Service) isClosed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.closed
+}
+
+func (s *Service) serve(l net.Listener, n *Network) error {
+	s.log.Info("listening", "addr", l.Addr().String(), "protocol_id", n.ProtocolId)
 	for {
 		conn, err := l.Accept()
 		if err != nil {
-			fmt.Println("Error accepting: ", err)
-		} else {
-			go func() {
-				fmt.Println("Peer connection from", conn.RemoteAddr())
-				ps := NewPeerSession(s, conn)
-				err := ps.handle()
-				ps.Close()
-				if err != nil {
-					fmt.Printf("Peer session (%v) error: %v\n", conn.RemoteAddr(), err)
-				}
-			}()
+			if s.isClosed() {
+				return nil
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				s.log.Error("error accepting", "err", err)
+				time.Sleep(ACCEPT_RETRY_DELAY)
+				continue
+			}
+			return err
+		}
+		go s.serveConn(conn, n)
+	}
+}
+
+// serveConn runs the whole session, returns the session error which is
+// already logged.
+func (s *Service) serveConn(conn net.Conn, n *Network) error {
+	if len(s.config.ProxyTrusted) > 0 {
+		proxied, err := proxyproto.Wrap(conn, s.config.ProxyTrusted, PROXY_HEADER_TIMEOUT)
+		if err != nil {
+			s.log.Info("rejected proxied connection",
+				"proxy_addr", conn.RemoteAddr().String(),
+				"err", err)
+			conn.Close()
+			return err
 		}
+		conn = proxied
+	}
+	if rule, banned := s.checkAddrBanned(conn.RemoteAddr()); banned {
+		s.log.Info("rejected banned peer",
+			"remote_addr", conn.RemoteAddr().String(),
+			"rule", rule.Value,
+			"reason", rule.Reason)
+		conn.Close()
+		return fmt.Errorf("banned address, reason: %v", rule.Reason)
+	}
+	if err := s.onConnect(conn); err != nil {
+		s.log.Info("rejected peer",
+			"remote_addr", conn.RemoteAddr().String(),
+			"err", err)
+		conn.Close()
+		return err
+	}
+	ps := newPeerSession(s, n, conn)
+	ps.log.Debug("peer connected")
+	err := ps.handle()
+	ps.Close()
+	s.onDisconnect(ps)
+	if err != nil {
+		ps.log.Warn("peer session error", "err", err)
+	} else {
+		ps.log.Debug("peer session finished")
+	}
+	return err
+}
+
+func (s *Service) checkAddrBanned(addr net.Addr) (ban.Rule, bool) {
+	if s.config.Bans == nil {
+		return ban.Rule{}, false
+	}
+	ip := addrIP(addr)
+	if ip == nil {
+		return ban.Rule{}, false
+	}
+	return s.config.Bans.CheckIP(ip)
+}
+
+func (s *Service) checkKeyBanned(key string) (ban.Rule, bool) {
+	if s.config.Bans == nil {
+		return ban.Rule{}, false
 	}
+	return s.config.Bans.CheckKey(key)
+}
+
+func (s *Service) nextSessionId() uint64 {
+	return atomic.AddUint64(&s.sessionNum, 1)
 }
 
-func (s *Service) genHello() *message.Hello {
+func (s *Service) genHello(n *Network) *message.Hello {
 	node := python.Node{
 		NodeName:     s.config.Name,
 		Key:          s.pubKeyHex,
-		PrvPort:      s.config.Port,
-		PubPort:      s.config.Port,
-		P2pPrvPort:   s.config.Port,
-		P2pPubPort:   s.config.Port,
+		PrvPort:      n.Port,
+		PubPort:      n.Port,
+		P2pPrvPort:   n.Port,
+		P2pPubPort:   n.Port,
 		PrvAddr:      s.config.PrvAddr,
 		PubAddr:      s.config.PubAddr,
 		PrvAddresses: s.config.PrvAddresses,
 		NatType:      s.config.NatType,
 	}
 	return &message.Hello{
-		Port:                 s.config.Port,
+		Port:                 n.Port,
 		NodeName:             s.config.Name,
 		ClientKeyId:          s.config.Id,
 		NodeInfo:             node.ToDict(),
-		RandVal:              rand.Float64(),
+		RandVal:              s.rand.Float64(),
 		Metadata:             make(map[string]interface{}),
 		SolveChallange:       false,
 		Challange:            nil,
 		Difficulty:           0,
-		ProtoId:              s.config.ProtocolId,
-		ClientVer:            s.config.GolemVersion,
-		GolemMessagesVersion: s.config.GolemMessagesVersion,
+		ProtoId:              n.ProtocolId,
+		ClientVer:            n.GolemVersion,
+		GolemMessagesVersion: n.GolemMessagesVersion,
 	}
 }